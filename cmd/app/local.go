@@ -0,0 +1,45 @@
+package main
+
+import (
+	queueclient "go_project_template/configs/queue_client"
+	consumerhandler "go_project_template/internal/consumer_handler"
+	"go_project_template/internal/mail"
+	"go_project_template/internal/notification"
+	"go_project_template/internal/template"
+	"time"
+)
+
+// newLocalNotificationWorker wires the notification service handlers to an
+// in-memory broker, mirroring cmd/notification.
+func newLocalNotificationWorker(broker *queueclient.MemoryBroker, emailSender mail.EmailSender, templates *template.Registry, publishedTemplates template.Source) *queueclient.MemorySubscriber {
+	consumerHandler := consumerhandler.NewConsumerHandler(emailSender, templates, publishedTemplates)
+
+	router := queueclient.NewRouter()
+	router.Use(
+		queueclient.Recovery(),
+		queueclient.Logging(),
+		queueclient.Deduplicate("notification", queueclient.NewMemoryDedupStore(), queueclient.DedupConfig{}),
+		queueclient.Timeout(30*time.Second),
+	)
+	router.Handle(notification.TypeEmailOTP, notification.TypeEmailOTPVersion, consumerHandler.SendEmail)
+
+	// Declare before the worker starts so early publishes are routable
+	broker.DeclareQueue(notification.MailQueue, notification.BindingKeyEmailAll)
+
+	return queueclient.NewMemorySubscriber(
+		queueclient.ConsumerConfig{
+			BindingKeys:     []string{notification.BindingKeyEmailAll},
+			QueueName:       notification.MailQueue,
+			Concurrency:     5,
+			ShutdownTimeout: 30 * time.Second,
+			Retry: queueclient.RetryConfig{
+				MaxAttempt:      5,
+				InitialInterval: 5 * time.Second,
+				Multiplier:      2,
+				MaxInterval:     5 * time.Minute,
+			},
+		},
+		router.HandlerFunc(),
+		broker,
+	)
+}
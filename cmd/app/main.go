@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
 	"go_project_template/configs/db"
 	queueclient "go_project_template/configs/queue_client"
 	"go_project_template/configs/redis"
+	"go_project_template/internal/emailtemplate"
+	templatecontroller "go_project_template/internal/emailtemplate/controller"
+	templaterepository "go_project_template/internal/emailtemplate/repository"
+	templateusecase "go_project_template/internal/emailtemplate/usecase"
 	"go_project_template/internal/mail"
+	"go_project_template/internal/notification"
+	"go_project_template/internal/outbox"
+	"go_project_template/internal/template"
 	"go_project_template/internal/user"
 	"go_project_template/internal/user/controller"
 	"go_project_template/internal/user/repository"
@@ -12,6 +20,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/gzip"
@@ -82,48 +91,160 @@ func main() {
 
 	// cloudClient.ListBuckets(context.Background())
 
-	// Setup RabbitMQ Client
-	rabbitMQ := queueclient.NewRabbitMQ(queueclient.RabbitConfig{
-		Protocol:       "amqp",
-		Username:       "ardimr",
-		Password:       "ardimr123",
-		Host:           "localhost",
-		Port:           5672,
-		VHost:          "/",
-		ConnectionName: "notification.service",
-	})
-
-	if err := rabbitMQ.Connect(); err != nil {
-		log.Fatalln(err)
+	// Email templates, managed through the template API and rendered by the
+	// notification worker. TEMPLATE_DIR reads the files from disk instead
+	templates := template.NewRegistry(os.Getenv("TEMPLATE_DIR"), template.BrandFromEnv())
+	templateRepository := templaterepository.NewTemplateRepository(dbConnection)
+	templateInvalidations := templaterepository.NewTemplateRedisRepository(redisClient)
+
+	// Email sender, for test sends of the templates and the in-process worker
+	var emailSender mail.EmailSender
+
+	if os.Getenv("CONFIG_SMTP_HOST") != "" {
+		smtpPort, err := strconv.Atoi(os.Getenv("CONFIG_SMTP_PORT"))
+		if err != nil {
+			log.Fatalln(err, "Invalid CONFIG_SMTP_PORT")
+		}
+
+		smtpSender, err := mail.NewSMTPSender(mail.SMTPConfig{
+			Host:        os.Getenv("CONFIG_SMTP_HOST"),
+			Port:        smtpPort,
+			Username:    os.Getenv("CONFIG_AUTH_EMAIL"),
+			Password:    os.Getenv("CONFIG_AUTH_PASSWORD"),
+			Auth:        os.Getenv("CONFIG_SMTP_AUTH"),
+			TLS:         os.Getenv("CONFIG_SMTP_TLS"),
+			HELO:        os.Getenv("CONFIG_SMTP_HELO"),
+			FromName:    os.Getenv("CONFIG_SENDER_NAME"),
+			FromAddress: os.Getenv("CONFIG_SENDER_EMAIL"),
+			ReplyTo:     os.Getenv("CONFIG_REPLY_TO"),
+			Timeout:     20 * time.Second,
+			// One connection per worker
+			PoolSize: 5,
+		}, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer smtpSender.Close()
+
+		emailSender = smtpSender
 	}
-	log.Println("Connected to RabbitMQ")
-	defer rabbitMQ.Close()
-
-	// Setup Publisher
-	publisher := queueclient.NewPublisher(
-		queueclient.PublisherConfig{
-			ExchangeName:   "",
-			ExchangeType:   "",
-			RoutingKey:     "",
-			PuublisherName: "NotificationPublisher",
-			PublisherCount: 1,
-			PrefetchCount:  1,
-			Reconnect: struct {
-				MaxAttempt int
-				Interval   time.Duration
-			}{
-				MaxAttempt: 10,
-				Interval:   1 * time.Second,
+
+	// Setup message broker
+	var publisher queueclient.Publisher
+
+	switch os.Getenv("BROKER") {
+	case "memory":
+		// Single binary local development, the notification worker runs
+		// in-process and messages are lost on restart
+		broker := queueclient.NewMemoryBroker()
+
+		if emailSender == nil {
+			log.Fatalln("CONFIG_SMTP_HOST is required with the in-memory broker")
+		}
+
+		publishedTemplates := emailtemplate.NewCache(templateRepository, time.Minute)
+		go func() {
+			if err := publishedTemplates.Listen(context.Background(), templateInvalidations); err != nil {
+				log.Println("Template invalidations stopped:", err)
+			}
+		}()
+
+		subscriber := newLocalNotificationWorker(broker, emailSender, templates, publishedTemplates)
+
+		go func() {
+			if err := subscriber.Start(context.Background()); err != nil {
+				log.Println(err)
+			}
+		}()
+		defer subscriber.Stop()
+
+		log.Println("Using in-memory broker")
+		publisher = broker
+	case "redis":
+		// Redis Streams, for deployments without RabbitMQ
+		publisher = queueclient.NewRedisPublisher(
+			queueclient.PublisherConfig{
+				ExchangeName: notification.Exchange,
+				Stream: queueclient.StreamConfig{
+					MaxLen: 100000,
+				},
 			},
-		},
-		rabbitMQ,
-	)
+			redisClient,
+		)
+		log.Println("Using Redis Streams broker")
+	default:
+		rabbitMQ := queueclient.NewRabbitMQ(queueclient.RabbitConfig{
+			Protocol:       "amqp",
+			Username:       "ardimr",
+			Password:       "ardimr123",
+			Host:           "localhost",
+			Port:           5672,
+			VHost:          "/",
+			ConnectionName: "notification.service",
+			Reconnect: queueclient.ReconnectConfig{
+				MaxAttempt: 0,
+				Interval:   2 * time.Second,
+			},
+		})
 
-	err = publisher.QueueDeclare("mailQueue")
-	if err != nil {
-		log.Fatalln(err)
+		if err := rabbitMQ.Connect(); err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("Connected to RabbitMQ")
+		defer rabbitMQ.Close()
+
+		// Setup Publisher
+		rabbitPublisher := queueclient.NewRabbitPublisher(
+			queueclient.PublisherConfig{
+				ExchangeName:   notification.Exchange,
+				ExchangeType:   notification.ExchangeType,
+				RoutingKey:     "",
+				PuublisherName: "NotificationPublisher",
+				PublisherCount: 4,
+				PrefetchCount:  1,
+				ConfirmTimeout: 5 * time.Second,
+				Exchange:       notification.ExchangeOptions,
+				Queue:          notification.MailQueueOptions,
+				Persistent:     true,
+				Reconnect: queueclient.ReconnectConfig{
+					MaxAttempt: 10,
+					Interval:   1 * time.Second,
+				},
+			},
+			rabbitMQ,
+		)
+
+		defer rabbitPublisher.Close()
+
+		err = rabbitPublisher.ExchangeDeclare()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		// Declare the mail queue too, so mail published before the worker
+		// first starts is kept instead of returned as unroutable
+		err = rabbitPublisher.QueueDeclare(notification.MailQueue, notification.BindingKeyEmailAll)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		publisher = rabbitPublisher
 	}
 
+	// Relay user-service events from the outbox table to the broker
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+
+	relay := outbox.NewRelay(
+		outbox.RelayConfig{
+			Interval:  500 * time.Millisecond,
+			BatchSize: 100,
+			Retention: 7 * 24 * time.Hour,
+		},
+		dbConnection,
+		publisher,
+	)
+	go relay.Start(relayCtx)
+
 	// Setup REST Server
 	restServer := gin.New()
 	restServer.Use(gin.Recovery())
@@ -133,13 +254,31 @@ func main() {
 	// Setup Router
 	userRepository := repository.NewUserRepository(dbConnection)
 	userCache := repository.NewUserRedisRepository(redisClient)
-	userUseCase := usecase.NewUserUseCae(userRepository, userCache, publisher)
+	outboxRepository := outbox.NewOutboxRepository(dbConnection)
+	userUseCase := usecase.NewUserUseCae(userRepository, userCache, outboxRepository)
 	userController := controller.NewUserController(userUseCase)
 	userRouter := user.NewRouter(userController)
 
 	userRouter.AddRoute(restServer.Group("/api"))
 
-	restServer.GET("/mail", mail.RenderTemplate)
+	// The template API needs TEMPLATE_API_KEY, test sends only go to the
+	// comma separated addresses and @domains of TEMPLATE_TEST_RECIPIENTS
+	templateUseCase := templateusecase.NewTemplateUseCase(
+		templateRepository,
+		templateInvalidations,
+		templates,
+		emailSender,
+		strings.Split(os.Getenv("TEMPLATE_TEST_RECIPIENTS"), ","),
+	)
+	templateController := templatecontroller.NewTemplateController(templateUseCase)
+	templateAPIKey := os.Getenv("TEMPLATE_API_KEY")
+	if templateAPIKey == "" {
+		log.Println("TEMPLATE_API_KEY is not set, the template API is disabled")
+	}
+	templateRouter := emailtemplate.NewRouter(templateController, templateAPIKey)
+
+	templateRouter.AddRoute(restServer.Group("/api"))
+
 	restServer.Run("localhost:8080")
 
 }
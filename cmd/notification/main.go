@@ -2,10 +2,18 @@ package main
 
 import (
 	"context"
+	_ "expvar"
+	"go_project_template/configs/db"
 	queueclient "go_project_template/configs/queue_client"
+	"go_project_template/configs/redis"
 	consumerhandler "go_project_template/internal/consumer_handler"
+	"go_project_template/internal/emailtemplate"
+	templaterepository "go_project_template/internal/emailtemplate/repository"
 	"go_project_template/internal/mail"
+	"go_project_template/internal/notification"
+	"go_project_template/internal/template"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -13,7 +21,6 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
-	"gopkg.in/gomail.v2"
 )
 
 func main() {
@@ -23,67 +30,173 @@ func main() {
 	godotenv.Load(".env")
 
 	// Email Sender
-	gmailPort, err := strconv.Atoi(os.Getenv("CONFIG_SMTP_PORT"))
+	smtpPort, err := strconv.Atoi(os.Getenv("CONFIG_SMTP_PORT"))
 	if err != nil {
-		log.Fatalln(err, "Failed to dial gmail")
+		log.Fatalln(err, "Invalid CONFIG_SMTP_PORT")
 	}
 
-	gmailDialer := gomail.NewDialer(
-		os.Getenv("CONFIG_SMTP_HOST"),
-		gmailPort,
-		os.Getenv("CONFIG_AUTH_EMAIL"),
-		os.Getenv("CONFIG_AUTH_PASSWORD"),
-	)
-	emailSender := mail.NewGmailSender(
-		gmailDialer,
-		os.Getenv("CONFIG_SENDER_NAME"),
-		os.Getenv("CONFIG_AUTH_EMAIL"),
-		os.Getenv("CONFIG_AUTH_PASSWORD"),
+	emailSender, err := mail.NewSMTPSender(mail.SMTPConfig{
+		Host:        os.Getenv("CONFIG_SMTP_HOST"),
+		Port:        smtpPort,
+		Username:    os.Getenv("CONFIG_AUTH_EMAIL"),
+		Password:    os.Getenv("CONFIG_AUTH_PASSWORD"),
+		Auth:        os.Getenv("CONFIG_SMTP_AUTH"),
+		TLS:         os.Getenv("CONFIG_SMTP_TLS"),
+		HELO:        os.Getenv("CONFIG_SMTP_HELO"),
+		FromName:    os.Getenv("CONFIG_SENDER_NAME"),
+		FromAddress: os.Getenv("CONFIG_SENDER_EMAIL"),
+		ReplyTo:     os.Getenv("CONFIG_REPLY_TO"),
+		Timeout:     20 * time.Second,
+		// One connection per worker
+		PoolSize: 5,
+	}, nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer emailSender.Close()
+
+	// Email templates are embedded, TEMPLATE_DIR reads them from disk instead
+	templates := template.NewRegistry(os.Getenv("TEMPLATE_DIR"), template.BrandFromEnv())
+
+	// Setup Redis client, used for deduplication, template invalidations and
+	// the Redis Streams broker
+	redisDB, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+
+	redisClient, err := redis.NewRedisClient(
+		os.Getenv("REDIS_HOST"),
+		os.Getenv("REDIS_PASSWORD"),
+		redisDB,
 	)
 
-	// Consumer Handler
-	consumerHandler := consumerhandler.NewConsumerHandler(emailSender)
-
-	// Setup RabbitMQ Client
-	rabbitMQ := queueclient.NewRabbitMQ(queueclient.RabbitConfig{
-		Protocol:       "amqp",
-		Username:       "ardimr",
-		Password:       "ardimr123",
-		Host:           "localhost",
-		Port:           5672,
-		VHost:          "/",
-		ConnectionName: "notification.service",
-	})
-
-	if err := rabbitMQ.Connect(); err != nil {
-		log.Fatalln(err)
+	if err != nil {
+		log.Fatalln("Failed to connect redis")
 	}
+	defer redisClient.Close()
 
-	log.Println("Connected to RabbitMQ")
-	defer rabbitMQ.Close()
+	// Versions published through the template API take precedence over the
+	// files, without a database only the files are used
+	var publishedTemplates template.Source
 
-	// Setup consumer
-	consumer := queueclient.NewConsumer(
-		queueclient.ConsumerConfig{
-			ExchangeName:  "",
-			ExchangeType:  "",
-			RoutingKey:    "",
-			QueueName:     "mailQueue",
-			ConsumerName:  "notification",
-			ConsumerCount: 1,
-			PrefetchCount: 1,
-			Concurrency:   1,
-			Reconnect: struct {
-				MaxAttempt int
-				Interval   time.Duration
-			}{
-				MaxAttempt: 10,
-				Interval:   1 * time.Second,
+	if os.Getenv("DB_HOST") != "" {
+		dbConnection, err := db.NewDB(
+			os.Getenv("DB_HOST"),
+			os.Getenv("DB_PORT"),
+			os.Getenv("DB_USER"),
+			os.Getenv("DB_PASSWORD"),
+			os.Getenv("DB_NAME"),
+		)
+
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+		defer dbConnection.Close()
+
+		cache := emailtemplate.NewCache(templaterepository.NewTemplateRepository(dbConnection), time.Minute)
+		go func() {
+			if err := cache.Listen(context.Background(), templaterepository.NewTemplateRedisRepository(redisClient)); err != nil {
+				log.Println("Template invalidations stopped:", err)
+			}
+		}()
+		publishedTemplates = cache
+	}
+
+	// Consumer Handler
+	consumerHandler := consumerhandler.NewConsumerHandler(emailSender, templates, publishedTemplates)
+
+	// Dispatch messages by type and schema version, skipping messages that
+	// were already handled
+	router := queueclient.NewRouter()
+	router.Use(
+		queueclient.Recovery(),
+		queueclient.Logging(),
+		queueclient.Metrics("notification"),
+		queueclient.Deduplicate(
+			"notification",
+			queueclient.NewRedisDedupStore(redisClient, "notification:processed:"),
+			queueclient.DedupConfig{
+				TTL:     24 * time.Hour,
+				LockTTL: time.Minute,
 			},
-		},
-		consumerHandler.SendEmail,
-		rabbitMQ,
+		),
+		queueclient.Timeout(30*time.Second),
 	)
+	router.Handle(notification.TypeEmailOTP, notification.TypeEmailOTPVersion, consumerHandler.SendEmail)
+
+	consumerConfig := queueclient.ConsumerConfig{
+		ExchangeName:    notification.Exchange,
+		ExchangeType:    notification.ExchangeType,
+		RoutingKey:      "",
+		BindingKeys:     []string{notification.BindingKeyEmailAll},
+		QueueName:       notification.MailQueue,
+		ConsumerName:    "notification",
+		ConsumerCount:   1,
+		PrefetchCount:   10,
+		Concurrency:     5,
+		ShutdownTimeout: 30 * time.Second,
+		Exchange:        notification.ExchangeOptions,
+		Queue:           notification.MailQueueOptions,
+		Lanes: []queueclient.PriorityLane{
+			{Name: "transactional", MinPriority: notification.PriorityTransactional, Weight: 10},
+			{Name: "bulk", MinPriority: 0, Weight: 1},
+		},
+		Retry: queueclient.RetryConfig{
+			MaxAttempt:      5,
+			InitialInterval: 5 * time.Second,
+			Multiplier:      2,
+			MaxInterval:     5 * time.Minute,
+		},
+		Reconnect: queueclient.ReconnectConfig{
+			MaxAttempt: 10,
+			Interval:   1 * time.Second,
+		},
+		Stream: queueclient.StreamConfig{
+			MaxLen:        100000,
+			ClaimMinIdle:  5 * time.Minute,
+			ClaimInterval: 30 * time.Second,
+		},
+	}
+
+	// Setup consumer
+	var consumer queueclient.Subscriber
+
+	switch os.Getenv("BROKER") {
+	case "redis":
+		consumer = queueclient.NewRedisConsumer(consumerConfig, router.HandlerFunc(), redisClient)
+	default:
+		rabbitMQ := queueclient.NewRabbitMQ(queueclient.RabbitConfig{
+			Protocol:       "amqp",
+			Username:       "ardimr",
+			Password:       "ardimr123",
+			Host:           "localhost",
+			Port:           5672,
+			VHost:          "/",
+			ConnectionName: "notification.service",
+			Reconnect: queueclient.ReconnectConfig{
+				MaxAttempt: 0,
+				Interval:   2 * time.Second,
+			},
+		})
+
+		if err := rabbitMQ.Connect(); err != nil {
+			log.Fatalln(err)
+		}
+
+		log.Println("Connected to RabbitMQ")
+		defer rabbitMQ.Close()
+
+		consumer = queueclient.NewRabbitConsumer(consumerConfig, router.HandlerFunc(), rabbitMQ)
+	}
+
+	// Serve the expvar metrics on /debug/vars
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = "localhost:9090"
+	}
+	go func() {
+		if err := http.ListenAndServe(metricsAddr, nil); err != nil {
+			log.Println("Metrics server stopped:", err)
+		}
+	}()
 
 	exit := make(chan os.Signal, 1)
 	signal.Notify(exit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
@@ -92,15 +205,17 @@ func main() {
 
 	// Start consumer
 	go func(ctx context.Context) {
-		if err := consumer.Start(ctx); err != nil {
-			log.Fatalln("Unable to start consumer")
+		if err := consumer.Start(ctx); err != nil && ctx.Err() == nil {
+			log.Fatalln("Unable to start consumer:", err)
 		}
 	}(ctx)
 
 	defer func() {
 		log.Println("Preparing to stop")
 		cancel()
-		consumer.Stop()
+		if err := consumer.Stop(); err != nil {
+			log.Println(err)
+		}
 	}()
 	// Wait for OS exit signal
 	<-exit
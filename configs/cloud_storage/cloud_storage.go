@@ -2,8 +2,10 @@ package cloudstorage
 
 import (
 	"context"
+	"io"
 )
 
 type CloudStorageInterface interface {
 	ListBuckets(ctx context.Context)
+	GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error)
 }
@@ -3,6 +3,7 @@ package cloudstorage
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 
 	"github.com/minio/minio-go/v7"
@@ -46,3 +47,8 @@ func (mc *Minio) ListBuckets(ctx context.Context) {
 		fmt.Println(bucket.Name)
 	}
 }
+
+// GetObject streams an object, the caller has to close it.
+func (mc *Minio) GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	return mc.conn.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+}
@@ -94,3 +94,19 @@ func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 
 	return db.DB.BeginTx(ctx, opts)
 }
+
+// Transaction runs fn in a transaction, committed when fn returns nil and
+// rolled back otherwise.
+func Transaction(ctx context.Context, db DBInterface, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
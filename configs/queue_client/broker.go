@@ -0,0 +1,38 @@
+package queueclient
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotScheduled = errors.New("queueclient: no pending scheduled message with this ID")
+
+// Publisher sends envelopes to a broker. Implementations only return nil once
+// the broker has taken responsibility for the message.
+type Publisher interface {
+	Publish(ctx context.Context, routingKey string, env Envelope) error
+}
+
+// ScheduledPublisher also delivers envelopes at a later time. Scheduled
+// messages are identified by their envelope ID; Cancel returns
+// ErrNotScheduled once the message was published or when it is unknown.
+type ScheduledPublisher interface {
+	Publisher
+	PublishAt(ctx context.Context, routingKey string, env Envelope, at time.Time) error
+	PublishAfter(ctx context.Context, routingKey string, env Envelope, delay time.Duration) error
+	Cancel(ctx context.Context, messageID string) error
+}
+
+// Subscriber consumes a queue, handing every message to a HandlerFunc.
+// Start blocks until the subscriber is stopped; Stop drains in-flight
+// messages and waits for Start to return.
+type Subscriber interface {
+	Start(ctx context.Context) error
+	Stop() error
+}
+
+var (
+	_ Publisher  = (*RabbitPublisher)(nil)
+	_ Subscriber = (*RabbitConsumer)(nil)
+)
@@ -0,0 +1,32 @@
+package queueclient
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpChannel is the part of *amqp.Channel used by the consumer. It lets the
+// consumer lifecycle be exercised against a fake broker in tests.
+type amqpChannel interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Close() error
+}
+
+// channelSource hands out channels and reports the connection state.
+type channelSource interface {
+	channel() (amqpChannel, error)
+	IsConnected() bool
+	NotifyReconnect() <-chan struct{}
+}
+
+func (c *RabbitMQ) channel() (amqpChannel, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
@@ -1,12 +1,41 @@
 package queueclient
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+var (
+	ErrNotConnected = errors.New("queueclient: not connected to rabbitmq")
+	ErrClientClosed = errors.New("queueclient: rabbitmq client is closed")
+)
+
+const defaultReconnectInterval = time.Second
+
+// ReconnectConfig bounds how often a lost connection or channel is retried.
+// A MaxAttempt of zero or less keeps retrying until the client is closed.
+type ReconnectConfig struct {
+	MaxAttempt int
+	Interval   time.Duration
+}
+
+// delay returns the configured interval plus up to 50% random jitter so that
+// every service does not hit the broker at the same moment after a restart.
+func (r ReconnectConfig) delay() time.Duration {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultReconnectInterval
+	}
+
+	return interval + time.Duration(rand.Int63n(int64(interval)/2+1))
+}
+
 type RabbitConfig struct {
 	Protocol       string
 	Username       string
@@ -15,22 +44,27 @@ type RabbitConfig struct {
 	Port           int
 	VHost          string
 	ConnectionName string
+	Reconnect      ReconnectConfig
 }
 
 type RabbitMQ struct {
-	config RabbitConfig
-	conn   *amqp.Connection
+	config      RabbitConfig
+	mu          sync.RWMutex
+	conn        *amqp.Connection
+	closing     bool
+	reconnected chan struct{}
+	topology    []func(*amqp.Channel) error
 }
 
 func NewRabbitMQ(config RabbitConfig) *RabbitMQ {
 	return &RabbitMQ{
-		config: config,
+		config:      config,
+		reconnected: make(chan struct{}),
 	}
 }
 
-func (c *RabbitMQ) Connect() error {
-
-	conn, err := amqp.Dial(
+func (c *RabbitMQ) dial() (*amqp.Connection, error) {
+	return amqp.Dial(
 		fmt.Sprintf(
 			"%s://%s:%s@%s:%d/",
 			c.config.Protocol,
@@ -40,17 +74,177 @@ func (c *RabbitMQ) Connect() error {
 			c.config.Port,
 		),
 	)
+}
+
+func (c *RabbitMQ) Connect() error {
+
+	conn, err := c.dial()
 
 	if err != nil {
 		return err
 	}
 
+	c.mu.Lock()
 	c.conn = conn
+	c.mu.Unlock()
+
+	go c.watch(conn)
+
+	return nil
+}
+
+// Channel opens a new channel on the current connection.
+func (c *RabbitMQ) Channel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closing {
+		return nil, ErrClientClosed
+	}
+	if c.conn == nil || c.conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+
+	return c.conn.Channel()
+}
+
+func (c *RabbitMQ) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.conn != nil && !c.conn.IsClosed()
+}
+
+// NotifyReconnect returns a channel that is closed the next time the client
+// re-establishes its connection.
+func (c *RabbitMQ) NotifyReconnect() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.reconnected
+}
+
+// Declare runs the given topology declaration now and again after every
+// reconnect, so queues and exchanges exist on a freshly restarted broker.
+func (c *RabbitMQ) Declare(declare func(*amqp.Channel) error) error {
+	ch, err := c.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := declare(ch); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.topology = append(c.topology, declare)
+	c.mu.Unlock()
 
 	return nil
 }
 
+func (c *RabbitMQ) redeclare(conn *amqp.Connection) error {
+	c.mu.RLock()
+	topology := c.topology
+	c.mu.RUnlock()
+
+	if len(topology) == 0 {
+		return nil
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for _, declare := range topology {
+		if err := declare(ch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// watch waits for the connection to close and reconnects unless the close
+// was requested through Close.
+func (c *RabbitMQ) watch(conn *amqp.Connection) {
+	err, ok := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	if c.isClosing() || !ok {
+		return
+	}
+
+	log.Println("RabbitMQ connection lost:", err)
+	c.reconnect()
+}
+
+func (c *RabbitMQ) reconnect() {
+	maxAttempt := c.config.Reconnect.MaxAttempt
+
+	for attempt := 1; maxAttempt <= 0 || attempt <= maxAttempt; attempt++ {
+		time.Sleep(c.config.Reconnect.delay())
+
+		if c.isClosing() {
+			return
+		}
+
+		conn, err := c.dial()
+		if err != nil {
+			log.Printf("Reconnect attempt %d to RabbitMQ failed: %s", attempt, err)
+			continue
+		}
+
+		// Close may have run while dialing
+		if c.isClosing() {
+			conn.Close()
+			return
+		}
+
+		if err := c.redeclare(conn); err != nil {
+			log.Printf("Failed to re-declare topology on attempt %d: %s", attempt, err)
+			conn.Close()
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closing {
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+		c.conn = conn
+		close(c.reconnected)
+		c.reconnected = make(chan struct{})
+		c.mu.Unlock()
+
+		go c.watch(conn)
+
+		log.Println("Reconnected to RabbitMQ")
+		return
+	}
+
+	log.Println("Giving up reconnecting to RabbitMQ")
+}
+
+func (c *RabbitMQ) isClosing() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.closing
+}
+
 func (c *RabbitMQ) Close() {
 	log.Println("Closing rabbitMQ Connection")
-	c.conn.Close()
+
+	c.mu.Lock()
+	c.closing = true
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
 }
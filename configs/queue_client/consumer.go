@@ -2,103 +2,273 @@ package queueclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
+var ErrShutdownTimeout = errors.New("queueclient: consumer shutdown timed out")
+
+// ConsumerConfig describes the queue to consume. When ExchangeName is set the
+// exchange is declared and the queue is bound to it with RoutingKey and every
+// pattern in BindingKeys, e.g. "notification.email.*" on a topic exchange.
+//
+// Throughput is shaped by three settings:
+//   - ConsumerCount is the number of channels subscribed to the queue. Each
+//     one is an independent flow from the broker; more than one mainly helps
+//     when a single channel is network or broker bound.
+//   - PrefetchCount is the per-channel limit of unacked deliveries, so at most
+//     ConsumerCount*PrefetchCount messages are held by the process. Keep it at
+//     least Concurrency/ConsumerCount or workers will idle waiting on the
+//     broker; much higher only moves messages away from other instances.
+//   - Concurrency is the size of the worker pool shared by all subscriptions
+//     and the number of handlers running at once. For I/O bound handlers such
+//     as SMTP sends, throughput grows roughly linearly with it until the
+//     downstream server throttles.
+//
+// ShutdownTimeout bounds how long in-flight handlers may run after the
+// consumer is asked to stop; unfinished deliveries are requeued.
+//
+// Exchange and Queue set how the exchange and the queue are declared, see
+// QueueOptions; the retry and dead-letter queues follow Queue.Durable.
+// Queue.MaxPriority declares a priority queue, so the broker hands out urgent
+// messages first. Received messages are then split into Lanes by their
+// priority and workers pick lanes by weight; without Lanes they are handled
+// in the order they arrive.
 type ConsumerConfig struct {
-	ExchangeName  string
-	ExchangeType  string
-	RoutingKey    string
-	QueueName     string
-	ConsumerName  string
-	ConsumerCount int
-	PrefetchCount int
-	Concurrency   int
-	Reconnect     struct {
-		MaxAttempt int
-		Interval   time.Duration
-	}
+	ExchangeName    string
+	ExchangeType    string
+	RoutingKey      string
+	BindingKeys     []string
+	QueueName       string
+	ConsumerName    string
+	ConsumerCount   int
+	PrefetchCount   int
+	Concurrency     int
+	ShutdownTimeout time.Duration
+	Exchange        ExchangeOptions
+	Queue           QueueOptions
+	Lanes           []PriorityLane
+	Retry           RetryConfig
+	Reconnect       ReconnectConfig
+	Stream          StreamConfig
 }
 
-type Consumer struct {
+type RabbitConsumer struct {
 	Config  ConsumerConfig
-	handler func(context.Context, []byte) error
+	handler HandlerFunc
 	client  *RabbitMQ
+	source  channelSource
+	retries republisher
+
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
 	done    chan struct{}
-	// cancel  context.CancelFunc
+	err     error
 }
 
-func NewConsumer(config ConsumerConfig, handler func(context.Context, []byte) error, client *RabbitMQ) *Consumer {
-	return &Consumer{
+func NewRabbitConsumer(config ConsumerConfig, handler HandlerFunc, client *RabbitMQ) *RabbitConsumer {
+	return &RabbitConsumer{
 		Config:  config,
 		handler: handler,
 		client:  client,
+		source:  client,
+		// Failed deliveries are republished on confirm-mode channels, one
+		// per worker
+		retries: NewRabbitPublisher(PublisherConfig{
+			PublisherCount: config.Concurrency,
+			Reconnect:      config.Reconnect,
+		}, client),
+		done: make(chan struct{}),
 	}
 }
 
-func (c *Consumer) ExchangeDeclare() error {
-	ch, err := c.client.conn.Channel()
+func (c *RabbitConsumer) ExchangeDeclare() error {
+	return c.client.Declare(func(ch *amqp.Channel) error {
+		return declareExchange(ch, c.Config.ExchangeName, c.Config.ExchangeType, c.Config.Exchange)
+	})
+}
+
+// Start consumes the queue until ctx is cancelled or Stop is called, then
+// drains: no new deliveries are accepted, in-flight handlers get
+// Config.ShutdownTimeout to finish and whatever is left is requeued. Start
+// returns ErrShutdownTimeout when handlers had to be abandoned.
+//
+// When the channel or the connection is lost, Start waits for the client to
+// reconnect and subscribes again, retrying as configured in Config.Reconnect.
+func (c *RabbitConsumer) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return errors.New("queueclient: consumer already started")
+	}
+	c.started = true
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.mu.Unlock()
+
+	err := c.run(ctx)
+	c.retries.Close()
 
+	c.mu.Lock()
+	c.cancel()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+
+	return err
+}
+
+func (c *RabbitConsumer) run(ctx context.Context) error {
+	reconnected := c.source.NotifyReconnect()
+	subs, err := c.subscribeAll()
 	if err != nil {
+		log.Println("Unable to start consumer")
 		return err
 	}
-	// Exchange Declaration
-	if err := ch.ExchangeDeclare(
-		c.Config.ExchangeName, // Name
-		c.Config.ExchangeType, // Type
-		false,                 // Durable
-		false,                 // Auto delete
-		false,                 // Internal
-		false,                 // No Wait
-		nil,                   // Arguments
-	); err != nil {
-		return err
+
+	log.Printf(" [*] Waiting for messages. To exit press CTRL+C")
+
+	for {
+		if err := c.consume(ctx, subs); err != nil || ctx.Err() != nil {
+			return err
+		}
+
+		// Only the channel was closed when the connection is still up
+		if !c.source.IsConnected() {
+			log.Println("Consumer channel closed, waiting for reconnection")
+			select {
+			case <-reconnected:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		reconnected = c.source.NotifyReconnect()
+		subs, err = c.resubscribe(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		log.Println("Consumer resumed")
 	}
-	return nil
 }
 
-func (c *Consumer) Start(ctx context.Context) error {
-	var wg *sync.WaitGroup = &sync.WaitGroup{}
+func (c *RabbitConsumer) resubscribe(ctx context.Context) ([]*subscription, error) {
+	for attempt := 1; ; attempt++ {
+		subs, err := c.subscribeAll()
+		if err == nil {
+			return subs, nil
+		}
+
+		log.Printf("Resubscribe attempt %d failed: %s", attempt, err)
+		if errors.Is(err, ErrClientClosed) {
+			return nil, err
+		}
+		if c.Config.Reconnect.MaxAttempt > 0 && attempt >= c.Config.Reconnect.MaxAttempt {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(c.Config.Reconnect.delay()):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// subscribeAll opens Config.ConsumerCount independent subscriptions.
+func (c *RabbitConsumer) subscribeAll() ([]*subscription, error) {
+	count := c.Config.ConsumerCount
+	if count < 1 {
+		count = 1
+	}
 
-	c.done = make(chan struct{})
+	subs := make([]*subscription, 0, count)
+	for i := 0; i < count; i++ {
+		sub, err := c.subscribe()
+		if err != nil {
+			for _, opened := range subs {
+				opened.ch.Close()
+			}
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
 
-	ch, err := c.client.conn.Channel()
+// subscription is one channel consuming the queue.
+type subscription struct {
+	ch         amqpChannel
+	tag        string
+	deliveries <-chan amqp.Delivery
+}
+
+// subscribe opens a channel, declares the queue topology and starts
+// consuming from it.
+func (c *RabbitConsumer) subscribe() (*subscription, error) {
+	ch, err := c.source.channel()
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Unacked deliveries the broker pushes to this channel
+	if c.Config.PrefetchCount > 0 {
+		if err := ch.Qos(
+			c.Config.PrefetchCount, // Prefetch Count
+			0,                      // Prefetch Size
+			false,                  // Global
+		); err != nil {
+			ch.Close()
+			return nil, err
+		}
 	}
 
 	// Exchange Declaration
-	// if err := ch.ExchangeDeclare(
-	// 	c.config.ExchangeName, // Name
-	// 	c.config.ExchangeType, // Type
-	// 	false,                 // Durable
-	// 	false,                 // Auto delete
-	// 	false,                 // Internal
-	// 	false,                 // No Wait
-	// 	nil,                   // Arguments
-	// ); err != nil {
-	// 	return err
-	// }
-
-	if _, err := ch.QueueDeclare(
-		c.Config.QueueName, // Name
-		false,              // Durable
-		false,              // Auto delete
-		false,              // Exclusive
-		false,              // No Wait
-		nil,                // Arguments
-	); err != nil {
-		return err
+	if c.Config.ExchangeName != "" {
+		if err := declareExchange(ch, c.Config.ExchangeName, c.Config.ExchangeType, c.Config.Exchange); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+
+	if err := declareQueue(ch, c.Config.QueueName, c.Config.Queue); err != nil {
+		ch.Close()
+		return nil, err
 	}
 
+	// Queue Bindings
+	if c.Config.ExchangeName != "" {
+		if err := bindQueue(ch, c.Config.QueueName, c.Config.ExchangeName, bindingKeys(c.Config)); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+
+	// Retry and dead-letter queues
+	if err := declareRetryTopology(ch, c.Config.QueueName, c.Config.Retry, c.Config.Queue.Durable); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	// The tag is needed to cancel the subscription when draining
+	tag := fmt.Sprintf("%s-%s", c.Config.ConsumerName, uuid.NewString())
+
 	deliveries, err := ch.Consume(
 		c.Config.QueueName, // Queue
-		"",                 // Consumer
+		tag,                // Consumer
 		false,              // Auto Ack
 		false,              // Exclusive
 		false,              // No local
@@ -106,62 +276,264 @@ func (c *Consumer) Start(ctx context.Context) error {
 		nil,                // Args
 	)
 	if err != nil {
-		log.Fatalln("Unable to start consumer")
-		return err
+		ch.Close()
+		return nil, err
+	}
+
+	return &subscription{
+		ch:         ch,
+		tag:        tag,
+		deliveries: deliveries,
+	}, nil
+}
+
+func bindingKeys(config ConsumerConfig) []string {
+	keys := make([]string, 0, len(config.BindingKeys)+1)
+	if config.RoutingKey != "" {
+		keys = append(keys, config.RoutingKey)
 	}
 
-	var forever chan struct{}
+	return append(keys, config.BindingKeys...)
+}
+
+// delivery is a message together with the subscription it arrived on,
+// which is where it has to be settled.
+type delivery struct {
+	sub *subscription
+	msg amqp.Delivery
+}
 
-	wg.Add(c.Config.Concurrency)
-	go func() {
-		defer close(c.done)
-		for i := 0; i < c.Config.Concurrency; i++ {
-			go func(deliveries <-chan amqp.Delivery) {
-				defer wg.Done()
-				for {
-					select {
-					case msg, ok := <-deliveries:
-						if !ok {
-							return
-						}
-						err := c.handler(ctx, msg.Body)
-						if err != nil {
-							log.Fatalln(err)
-						}
-
-						// Commit the delivery
-						ackErr := msg.Ack(false)
-						if ackErr != nil {
-							log.Fatalln(ackErr)
-						}
-					case <-ctx.Done():
-						log.Println("Stopped receiving message from queue")
-						err := ch.Close()
-						if err != nil {
-							log.Println(err)
-						}
+type deliveryKey struct {
+	sub *subscription
+	tag uint64
+}
+
+// inflight tracks deliveries whose handler is running so they can be
+// requeued if the handler outlives the shutdown deadline.
+type inflight struct {
+	mu         sync.Mutex
+	deliveries map[deliveryKey]amqp.Delivery
+}
+
+func (f *inflight) add(d delivery) {
+	f.mu.Lock()
+	f.deliveries[deliveryKey{d.sub, d.msg.DeliveryTag}] = d.msg
+	f.mu.Unlock()
+}
+
+// remove reports false when the delivery was already requeued by abandon.
+func (f *inflight) remove(d delivery) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := deliveryKey{d.sub, d.msg.DeliveryTag}
+	_, ok := f.deliveries[key]
+	delete(f.deliveries, key)
+	return ok
+}
+
+// abandon requeues every delivery still being handled.
+func (f *inflight) abandon() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	abandoned := len(f.deliveries)
+	for key, msg := range f.deliveries {
+		if err := msg.Nack(false, true); err != nil {
+			log.Println(err)
+		}
+		delete(f.deliveries, key)
+	}
+	return abandoned
+}
+
+// consume feeds the deliveries of every subscription to a shared pool of
+// Config.Concurrency workers through the priority lanes. Forwarders move
+// deliveries to the lanes as soon as they arrive, the number buffered is
+// bounded by the prefetch of the subscriptions. It returns nil when a
+// subscription was lost, after closing the others so the group can be
+// resubscribed, and the result of drain when ctx was cancelled.
+func (c *RabbitConsumer) consume(ctx context.Context, subs []*subscription) error {
+	var wg *sync.WaitGroup = &sync.WaitGroup{}
+
+	// Handlers keep running through the drain, so they are only cancelled
+	// once the shutdown deadline has passed.
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	work := newLaneQueue[delivery](c.Config.Lanes, 0)
+	draining := make(chan struct{})
+	lost := make(chan struct{})
+	var lostOnce sync.Once
+	running := &inflight{deliveries: map[deliveryKey]amqp.Delivery{}}
+
+	// One forwarder per subscription
+	wg.Add(len(subs))
+	for _, sub := range subs {
+		go func(sub *subscription) {
+			defer wg.Done()
+			for {
+				select {
+				case <-draining:
+					return
+				case msg, ok := <-sub.deliveries:
+					if !ok {
+						lostOnce.Do(func() { close(lost) })
+						return
 					}
+					work.push(msg.Priority, delivery{sub: sub, msg: msg}, draining)
 				}
-			}(deliveries)
-		}
+			}
+		}(sub)
+	}
+
+	workers := c.Config.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				d, ok := work.pop(draining)
+				if !ok {
+					return
+				}
+				c.handle(handlerCtx, running, d)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
 		wg.Wait()
-		// Return if the context is cancelled
-		if ctx.Err() != nil {
-			return
-		}
+		close(finished)
 	}()
 
-	log.Printf(" [*] Waiting for messages. To exit press CTRL+C")
-	<-forever
-	return nil
+	select {
+	case <-lost:
+		// Unacked deliveries are requeued by the broker with their channel
+		for _, sub := range subs {
+			sub.ch.Close()
+		}
+		close(draining)
+		<-finished
+		work.drain()
+		return nil
+	case <-ctx.Done():
+	}
+
+	return c.drain(subs, work, draining, finished, running, cancelHandlers)
 }
 
-func (c *Consumer) Channel() (*amqp.Channel, error) {
-	return c.client.conn.Channel()
+func (c *RabbitConsumer) handle(ctx context.Context, running *inflight, d delivery) {
+	running.add(d)
+	err := c.handler(ctx, messageFromDelivery(d.msg))
+	if !running.remove(d) {
+		// Already requeued after the shutdown deadline
+		return
+	}
+
+	if err != nil {
+		log.Println("Failed to handle message:", err)
+		if err := handleFailure(ctx, c.retries, c.Config.QueueName, c.Config.Retry, d.msg, err); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	// Commit the delivery
+	if err := d.msg.Ack(false); err != nil {
+		log.Println(err)
+	}
 }
 
-func (c *Consumer) Stop() {
+// drain stops every subscription and waits for in-flight handlers.
+func (c *RabbitConsumer) drain(subs []*subscription, work *laneQueue[delivery], draining chan struct{}, finished <-chan struct{}, running *inflight, cancelHandlers context.CancelFunc) error {
+	log.Println("Stopped receiving message from queue")
+
+	// Stop new deliveries and let the workers finish their current message
+	closed := map[*subscription]bool{}
+	for _, sub := range subs {
+		if err := sub.ch.Cancel(sub.tag, false); err != nil {
+			// Closing the channel also ends the deliveries
+			log.Println(err)
+			sub.ch.Close()
+			closed[sub] = true
+		}
+	}
+	close(draining)
+
+	timeout := c.Config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-finished:
+	case <-timer.C:
+		cancelHandlers()
+		abandoned := running.abandon()
+		err = fmt.Errorf("%w: requeued %d in-flight deliveries", ErrShutdownTimeout, abandoned)
+	}
+
+	// Deliveries buffered but never started go back to the queue
+	requeued := 0
+	for _, d := range work.drain() {
+		if nackErr := d.msg.Nack(false, true); nackErr != nil {
+			log.Println(nackErr)
+		}
+		requeued++
+	}
+	for _, sub := range subs {
+		for msg := range sub.deliveries {
+			if nackErr := msg.Nack(false, true); nackErr != nil {
+				log.Println(nackErr)
+			}
+			requeued++
+		}
+	}
+	if requeued > 0 {
+		log.Printf("Requeued %d buffered deliveries", requeued)
+	}
+
+	for _, sub := range subs {
+		if closed[sub] {
+			continue
+		}
+		if closeErr := sub.ch.Close(); closeErr != nil {
+			log.Println(closeErr)
+		}
+	}
+
+	return err
+}
+
+func (c *RabbitConsumer) Channel() (*amqp.Channel, error) {
+	return c.client.Channel()
+}
+
+// Stop asks a running consumer to drain and waits for Start to return,
+// returning its error. It returns immediately if Start was never called.
+func (c *RabbitConsumer) Stop() error {
+	c.mu.Lock()
+	if !c.started {
+		c.mu.Unlock()
+		return nil
+	}
+	c.cancel()
+	c.mu.Unlock()
+
 	log.Println("Waiting for workers to finish")
 	<-c.done
 	log.Println("Consumer is stopped ...")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
 }
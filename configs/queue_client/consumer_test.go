@@ -0,0 +1,236 @@
+package queueclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBroker is a single-channel broker that records how deliveries were
+// settled.
+type fakeBroker struct {
+	mu         sync.Mutex
+	deliveries chan amqp.Delivery
+	closeOnce  sync.Once
+	cancelled  chan struct{}
+	acked      []uint64
+	requeued   []uint64
+	published  []amqp.Publishing
+	publishTo  []string
+	publishErr error
+	prefetch   []int
+	queues     []declaredQueue
+}
+
+type declaredQueue struct {
+	name    string
+	durable bool
+	args    amqp.Table
+}
+
+func newFakeBroker(messages int) *fakeBroker {
+	b := &fakeBroker{
+		deliveries: make(chan amqp.Delivery, messages),
+		cancelled:  make(chan struct{}),
+	}
+	for i := 1; i <= messages; i++ {
+		b.deliveries <- amqp.Delivery{
+			Acknowledger: b,
+			DeliveryTag:  uint64(i),
+			Type:         "email.otp",
+		}
+	}
+	return b
+}
+
+func (b *fakeBroker) Ack(tag uint64, multiple bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acked = append(b.acked, tag)
+	return nil
+}
+
+func (b *fakeBroker) Nack(tag uint64, multiple bool, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if requeue {
+		b.requeued = append(b.requeued, tag)
+	}
+	return nil
+}
+
+func (b *fakeBroker) Reject(tag uint64, requeue bool) error {
+	return b.Nack(tag, false, requeue)
+}
+
+func (b *fakeBroker) settled() ([]uint64, []uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]uint64{}, b.acked...), append([]uint64{}, b.requeued...)
+}
+
+func (b *fakeBroker) channel() (amqpChannel, error)    { return b, nil }
+func (b *fakeBroker) IsConnected() bool                { return true }
+func (b *fakeBroker) NotifyReconnect() <-chan struct{} { return make(chan struct{}) }
+
+func (b *fakeBroker) Qos(prefetchCount, prefetchSize int, global bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prefetch = append(b.prefetch, prefetchCount)
+	return nil
+}
+
+func (b *fakeBroker) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (b *fakeBroker) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queues = append(b.queues, declaredQueue{name: name, durable: durable, args: args})
+	return amqp.Queue{Name: name}, nil
+}
+
+func (b *fakeBroker) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (b *fakeBroker) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return b.deliveries, nil
+}
+
+// Cancel behaves like amqp091: buffered deliveries are still handed out and
+// the channel is closed afterwards.
+func (b *fakeBroker) Cancel(consumer string, noWait bool) error {
+	b.closeOnce.Do(func() {
+		close(b.deliveries)
+		close(b.cancelled)
+	})
+	return nil
+}
+
+// fakeRepublisher confirms republished deliveries on behalf of the broker,
+// unless publishErr is set.
+type fakeRepublisher struct {
+	broker *fakeBroker
+}
+
+func (r fakeRepublisher) publish(ctx context.Context, routingKey string, msg amqp.Publishing) error {
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.publishErr != nil {
+		return b.publishErr
+	}
+	b.publishTo = append(b.publishTo, routingKey)
+	b.published = append(b.published, msg)
+	return nil
+}
+
+func (r fakeRepublisher) Close() {}
+
+func (b *fakeBroker) Close() error {
+	return b.Cancel("", false)
+}
+
+func newFakeConsumer(broker *fakeBroker, timeout time.Duration, handler HandlerFunc) *RabbitConsumer {
+	return &RabbitConsumer{
+		Config: ConsumerConfig{
+			QueueName:       "mailQueue",
+			ConsumerName:    "test",
+			Concurrency:     1,
+			ShutdownTimeout: timeout,
+		},
+		handler: handler,
+		source:  broker,
+		retries: fakeRepublisher{broker},
+		done:    make(chan struct{}),
+	}
+}
+
+func TestConsumerDrainsInFlightAndRequeuesBuffered(t *testing.T) {
+	broker := newFakeBroker(3)
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+
+	consumer := newFakeConsumer(broker, time.Second, func(ctx context.Context, msg Message) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	result := make(chan error, 1)
+	go func() { result <- consumer.Start(context.Background()) }()
+
+	<-started
+	stopped := make(chan error, 1)
+	go func() { stopped <- consumer.Stop() }()
+
+	// Finish the in-flight handler only after the subscription is cancelled
+	<-broker.cancelled
+	close(release)
+
+	require.NoError(t, <-result)
+	require.NoError(t, <-stopped)
+
+	acked, requeued := broker.settled()
+	assert.Equal(t, []uint64{1}, acked)
+	assert.Equal(t, []uint64{2, 3}, requeued)
+}
+
+func TestConsumerRequeuesHandlersPastShutdownTimeout(t *testing.T) {
+	broker := newFakeBroker(1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	returned := make(chan struct{})
+
+	consumer := newFakeConsumer(broker, 20*time.Millisecond, func(ctx context.Context, msg Message) error {
+		close(started)
+		<-release
+		close(returned)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- consumer.Start(ctx) }()
+
+	<-started
+	cancel()
+
+	err := <-result
+	assert.ErrorIs(t, err, ErrShutdownTimeout)
+
+	// The late handler must not ack a delivery that was already requeued
+	close(release)
+	<-returned
+
+	acked, requeued := broker.settled()
+	assert.Empty(t, acked)
+	assert.Equal(t, []uint64{1}, requeued)
+}
+
+func TestConsumerStopWithoutStart(t *testing.T) {
+	consumer := newFakeConsumer(newFakeBroker(0), time.Second, nil)
+
+	assert.NoError(t, consumer.Stop())
+}
+
+func TestConsumerAppliesConsumerCountAndPrefetch(t *testing.T) {
+	broker := newFakeBroker(0)
+	consumer := newFakeConsumer(broker, time.Second, nil)
+	consumer.Config.ConsumerCount = 3
+	consumer.Config.PrefetchCount = 20
+
+	subs, err := consumer.subscribeAll()
+	require.NoError(t, err)
+
+	assert.Len(t, subs, 3)
+	assert.Equal(t, []int{20, 20, 20}, broker.prefetch)
+	assert.NotEqual(t, subs[0].tag, subs[1].tag)
+}
@@ -0,0 +1,187 @@
+package queueclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultDedupTTL     = 24 * time.Hour
+	defaultDedupLockTTL = 5 * time.Minute
+
+	dedupProcessing = "processing"
+	dedupDone       = "done"
+)
+
+var ErrDuplicateInProgress = errors.New("queueclient: message is being handled by another worker")
+
+// DedupStore records which message IDs have been processed.
+type DedupStore interface {
+	// Claim marks id as in progress for ttl. It returns claimed false when
+	// the id is already claimed, and done true when it was processed.
+	Claim(ctx context.Context, id string, ttl time.Duration) (claimed bool, done bool, err error)
+	// Complete marks id as processed for ttl.
+	Complete(ctx context.Context, id string, ttl time.Duration) error
+	// Release drops the claim on id so a redelivery can process it.
+	Release(ctx context.Context, id string) error
+}
+
+// DedupConfig controls Deduplicate. TTL is how long processed IDs are
+// remembered and has to cover the longest redelivery window, retries
+// included. LockTTL bounds how long a claim of a crashed worker blocks
+// redeliveries; keep it above the handler timeout.
+type DedupConfig struct {
+	TTL     time.Duration
+	LockTTL time.Duration
+}
+
+// Deduplicate handles every message ID at most once successfully. The ID is
+// claimed before the handler runs and marked done when it succeeds, released
+// when it fails so the retry is handled. Duplicates of processed messages are
+// acknowledged without calling the handler and counted per message type in
+// the expvar map "<name>.duplicates". A duplicate arriving while the original
+// is still being handled fails with ErrDuplicateInProgress and is retried.
+func Deduplicate(name string, store DedupStore, config DedupConfig) Middleware {
+	if config.TTL <= 0 {
+		config.TTL = defaultDedupTTL
+	}
+	if config.LockTTL <= 0 {
+		config.LockTTL = defaultDedupLockTTL
+	}
+
+	duplicates := expvarMap(name + ".duplicates")
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			if msg.ID == "" {
+				return next(ctx, msg)
+			}
+
+			claimed, done, err := store.Claim(ctx, msg.ID, config.LockTTL)
+			if err != nil {
+				return err
+			}
+
+			if !claimed {
+				if done {
+					duplicates.Add(msg.Type, 1)
+					return nil
+				}
+				return ErrDuplicateInProgress
+			}
+
+			if err := next(ctx, msg); err != nil {
+				// The claim is only released, a lost release expires with LockTTL
+				store.Release(context.Background(), msg.ID)
+				return err
+			}
+
+			// The message was handled, failing it now would only handle it again
+			if err := store.Complete(context.Background(), msg.ID, config.TTL); err != nil {
+				log.Println("Failed to record processed message:", err)
+			}
+			return nil
+		}
+	}
+}
+
+// RedisDedupStore keeps processed IDs in Redis under prefix+id.
+type RedisDedupStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisDedupStore(client *redis.Client, prefix string) *RedisDedupStore {
+	return &RedisDedupStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (s *RedisDedupStore) Claim(ctx context.Context, id string, ttl time.Duration) (bool, bool, error) {
+	claimed, err := s.client.SetNX(ctx, s.prefix+id, dedupProcessing, ttl).Result()
+	if err != nil || claimed {
+		return claimed, false, err
+	}
+
+	state, err := s.client.Get(ctx, s.prefix+id).Result()
+	if errors.Is(err, redis.Nil) {
+		// Expired in between, claim again
+		return s.Claim(ctx, id, ttl)
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	return false, state == dedupDone, nil
+}
+
+func (s *RedisDedupStore) Complete(ctx context.Context, id string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+id, dedupDone, ttl).Err()
+}
+
+func (s *RedisDedupStore) Release(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.prefix+id).Err()
+}
+
+type dedupEntry struct {
+	state   string
+	expires time.Time
+}
+
+// MemoryDedupStore is an in-process DedupStore for tests and the in-memory
+// broker.
+type MemoryDedupStore struct {
+	mu      sync.Mutex
+	entries map[string]dedupEntry
+}
+
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{
+		entries: map[string]dedupEntry{},
+	}
+}
+
+func (s *MemoryDedupStore) Claim(ctx context.Context, id string, ttl time.Duration) (bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id]
+	if ok && time.Now().Before(entry.expires) {
+		return false, entry.state == dedupDone, nil
+	}
+
+	s.entries[id] = dedupEntry{state: dedupProcessing, expires: time.Now().Add(ttl)}
+	return true, false, nil
+}
+
+func (s *MemoryDedupStore) Complete(ctx context.Context, id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[id] = dedupEntry{state: dedupDone, expires: time.Now().Add(ttl)}
+
+	// Sweep expired entries now and then to bound memory
+	if len(s.entries)%1024 == 0 {
+		now := time.Now()
+		for key, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryDedupStore) Release(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, id)
+	return nil
+}
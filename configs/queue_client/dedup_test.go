@@ -0,0 +1,78 @@
+package queueclient_test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	queueclient "go_project_template/configs/queue_client"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicateSuppressesProcessedMessages(t *testing.T) {
+	calls := 0
+	handler := queueclient.Deduplicate("dedup_test_processed", queueclient.NewMemoryDedupStore(), queueclient.DedupConfig{})(
+		func(ctx context.Context, msg queueclient.Message) error {
+			calls++
+			return nil
+		},
+	)
+
+	// The expvar map is global, so only count what this test adds
+	duplicates := func() int64 {
+		counter, ok := expvar.Get("dedup_test_processed.duplicates").(*expvar.Map).Get("email.otp").(*expvar.Int)
+		if !ok {
+			return 0
+		}
+		return counter.Value()
+	}
+	before := duplicates()
+
+	msg := queueclient.Message{Envelope: queueclient.Envelope{ID: "msg-1", Type: "email.otp"}}
+	require.NoError(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), msg))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(1), duplicates()-before)
+}
+
+func TestDeduplicateReleasesFailedMessages(t *testing.T) {
+	calls := 0
+	handler := queueclient.Deduplicate("dedup_test_failed", queueclient.NewMemoryDedupStore(), queueclient.DedupConfig{})(
+		func(ctx context.Context, msg queueclient.Message) error {
+			calls++
+			if calls == 1 {
+				return errors.New("smtp unavailable")
+			}
+			return nil
+		},
+	)
+
+	msg := queueclient.Message{Envelope: queueclient.Envelope{ID: "msg-1", Type: "email.otp"}}
+	assert.Error(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), msg))
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestDeduplicateRetriesDuplicateInProgress(t *testing.T) {
+	store := queueclient.NewMemoryDedupStore()
+	msg := queueclient.Message{Envelope: queueclient.Envelope{ID: "msg-1", Type: "email.otp"}}
+
+	var nested error
+	handler := queueclient.Deduplicate("dedup_test_in_progress", store, queueclient.DedupConfig{})(
+		func(ctx context.Context, msg queueclient.Message) error {
+			// A redelivery arriving while the first copy is still handled
+			nested = queueclient.Deduplicate("dedup_test_in_progress", store, queueclient.DedupConfig{})(
+				func(ctx context.Context, msg queueclient.Message) error { return nil },
+			)(ctx, msg)
+			return nil
+		},
+	)
+
+	require.NoError(t, handler(context.Background(), msg))
+	assert.ErrorIs(t, nested, queueclient.ErrDuplicateInProgress)
+}
@@ -0,0 +1,29 @@
+package queueclient
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrPublishNacked     = errors.New("queueclient: message was nacked by the broker")
+	ErrPublishTimeout    = errors.New("queueclient: timed out waiting for publish confirmation")
+	ErrPublishUnroutable = errors.New("queueclient: message could not be routed to any queue")
+)
+
+// PublishError is returned by Publisher.Publish implementations when the
+// broker did not take responsibility for a message.
+type PublishError struct {
+	Exchange   string
+	RoutingKey string
+	MessageID  string
+	Err        error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("publish message %q to exchange %q with routing key %q: %s", e.MessageID, e.Exchange, e.RoutingKey, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,410 @@
+package queueclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a message that exhausted its retries or failed permanently.
+type DeadLetter struct {
+	Message
+	Reason string
+}
+
+type memoryQueue struct {
+	mu          sync.Mutex
+	bindings    []string
+	messages    []Message
+	ready       chan struct{}
+	deadLetters []DeadLetter
+}
+
+// push keeps the queue ordered by priority like a RabbitMQ priority queue,
+// messages of equal priority stay in publish order.
+func (q *memoryQueue) push(msg Message) {
+	q.mu.Lock()
+	i := len(q.messages)
+	for i > 0 && q.messages[i-1].Priority < msg.Priority {
+		i--
+	}
+	q.messages = append(q.messages, Message{})
+	copy(q.messages[i+1:], q.messages[i:])
+	q.messages[i] = msg
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop blocks until a message is available or done is closed.
+func (q *memoryQueue) pop(done <-chan struct{}) (Message, bool) {
+	for {
+		select {
+		case <-done:
+			return Message{}, false
+		default:
+		}
+
+		q.mu.Lock()
+		if len(q.messages) > 0 {
+			msg := q.messages[0]
+			q.messages = q.messages[1:]
+			more := len(q.messages) > 0
+			q.mu.Unlock()
+
+			// Wake up another waiting worker
+			if more {
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+			return msg, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-done:
+			return Message{}, false
+		}
+	}
+}
+
+func (q *memoryQueue) routes(name string, routingKey string) bool {
+	return routes(q.bindings, name, routingKey)
+}
+
+// MemoryBroker is an in-process broker with the same routing, retry and
+// dead-letter semantics as the RabbitMQ implementation. Every queue is bound
+// to a single topic namespace; a queue also receives messages published with
+// its own name as routing key, like the AMQP default exchange. It is meant for
+// tests and single-process local development, messages do not survive a
+// restart.
+type MemoryBroker struct {
+	mu     sync.RWMutex
+	queues map[string]*memoryQueue
+
+	scheduleMu sync.Mutex
+	scheduled  map[string]*time.Timer
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues:    map[string]*memoryQueue{},
+		scheduled: map[string]*time.Timer{},
+	}
+}
+
+// DeclareQueue creates the queue if needed and adds the binding patterns.
+func (b *MemoryBroker) DeclareQueue(name string, bindingKeys ...string) {
+	b.queue(name, bindingKeys...)
+}
+
+func (b *MemoryBroker) queue(name string, bindingKeys ...string) *memoryQueue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{ready: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+
+	q.mu.Lock()
+	q.bindings = append(q.bindings, bindingKeys...)
+	q.mu.Unlock()
+
+	return q
+}
+
+// Publish delivers the envelope to every matching queue. Like a mandatory
+// AMQP publish, it fails with ErrPublishUnroutable when no queue matches.
+func (b *MemoryBroker) Publish(ctx context.Context, routingKey string, env Envelope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	routed := false
+	for name, q := range b.queues {
+		q.mu.Lock()
+		match := q.routes(name, routingKey)
+		q.mu.Unlock()
+
+		if match {
+			q.push(Message{
+				Envelope:   env,
+				RoutingKey: routingKey,
+				Attempt:    1,
+			})
+			routed = true
+		}
+	}
+
+	if !routed {
+		return &PublishError{
+			RoutingKey: routingKey,
+			MessageID:  env.ID,
+			Err:        ErrPublishUnroutable,
+		}
+	}
+
+	return nil
+}
+
+// PublishAt publishes the envelope at the given time. Routing is only
+// checked then, an unroutable scheduled message is logged and dropped.
+func (b *MemoryBroker) PublishAt(ctx context.Context, routingKey string, env Envelope, at time.Time) error {
+	return b.PublishAfter(ctx, routingKey, env, time.Until(at))
+}
+
+func (b *MemoryBroker) PublishAfter(ctx context.Context, routingKey string, env Envelope, delay time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.scheduleMu.Lock()
+	defer b.scheduleMu.Unlock()
+
+	b.scheduled[env.ID] = time.AfterFunc(delay, func() {
+		b.scheduleMu.Lock()
+		delete(b.scheduled, env.ID)
+		b.scheduleMu.Unlock()
+
+		if err := b.Publish(context.Background(), routingKey, env); err != nil {
+			log.Println("Failed to publish scheduled message:", err)
+		}
+	})
+
+	return nil
+}
+
+// Cancel stops a scheduled message that was not published yet.
+func (b *MemoryBroker) Cancel(ctx context.Context, messageID string) error {
+	b.scheduleMu.Lock()
+	defer b.scheduleMu.Unlock()
+
+	timer, ok := b.scheduled[messageID]
+	if !ok || !timer.Stop() {
+		return ErrNotScheduled
+	}
+	delete(b.scheduled, messageID)
+
+	return nil
+}
+
+// Pending returns the number of messages waiting in the queue.
+func (b *MemoryBroker) Pending(queue string) int {
+	q := b.queue(queue)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+// DeadLetters returns the messages dead-lettered from the queue.
+func (b *MemoryBroker) DeadLetters(queue string) []DeadLetter {
+	q := b.queue(queue)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetter{}, q.deadLetters...)
+}
+
+// MemorySubscriber consumes a MemoryBroker queue. It honours QueueName,
+// RoutingKey, BindingKeys, Concurrency, ShutdownTimeout and Retry from the
+// ConsumerConfig; the RabbitMQ specific settings are ignored. Queues are
+// always strictly ordered by priority, Lanes are not used.
+type MemorySubscriber struct {
+	Config  ConsumerConfig
+	handler HandlerFunc
+	broker  *MemoryBroker
+
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+func NewMemorySubscriber(config ConsumerConfig, handler HandlerFunc, broker *MemoryBroker) *MemorySubscriber {
+	return &MemorySubscriber{
+		Config:  config,
+		handler: handler,
+		broker:  broker,
+		done:    make(chan struct{}),
+	}
+}
+
+var (
+	_ ScheduledPublisher = (*MemoryBroker)(nil)
+	_ Subscriber         = (*MemorySubscriber)(nil)
+)
+
+// Start consumes the queue until ctx is cancelled or Stop is called, with
+// the same drain semantics as RabbitConsumer.Start.
+func (s *MemorySubscriber) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return errors.New("queueclient: subscriber already started")
+	}
+	s.started = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+
+	err := s.run(ctx)
+
+	s.mu.Lock()
+	s.cancel()
+	s.err = err
+	s.mu.Unlock()
+	close(s.done)
+
+	return err
+}
+
+func (s *MemorySubscriber) run(ctx context.Context) error {
+	var wg *sync.WaitGroup = &sync.WaitGroup{}
+
+	q := s.broker.queue(s.Config.QueueName, bindingKeys(s.Config)...)
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	draining := make(chan struct{})
+	running := &memoryInflight{messages: map[*Message]struct{}{}}
+
+	workers := s.Config.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				msg, ok := q.pop(draining)
+				if !ok {
+					return
+				}
+				s.handle(handlerCtx, q, running, &msg)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	<-ctx.Done()
+	close(draining)
+
+	timeout := s.Config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-finished:
+		return nil
+	case <-timer.C:
+		cancelHandlers()
+		abandoned := running.abandon(q)
+		return fmt.Errorf("%w: requeued %d in-flight deliveries", ErrShutdownTimeout, abandoned)
+	}
+}
+
+func (s *MemorySubscriber) handle(ctx context.Context, q *memoryQueue, running *memoryInflight, msg *Message) {
+	running.add(msg)
+	err := s.handler(ctx, *msg)
+	if !running.remove(msg) {
+		// Already requeued after the shutdown deadline
+		return
+	}
+
+	if err == nil {
+		return
+	}
+
+	log.Println("Failed to handle message:", err)
+	retry := s.Config.Retry
+	if msg.Attempt > retry.maxRetry() || IsPermanent(err) {
+		q.mu.Lock()
+		q.deadLetters = append(q.deadLetters, DeadLetter{Message: *msg, Reason: err.Error()})
+		q.mu.Unlock()
+		return
+	}
+
+	next := *msg
+	next.Attempt++
+	next.Redelivered = true
+	time.AfterFunc(retry.Backoff(msg.Attempt), func() {
+		q.push(next)
+	})
+}
+
+// Stop asks a running subscriber to drain and waits for Start to return.
+func (s *MemorySubscriber) Stop() error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return nil
+	}
+	s.cancel()
+	s.mu.Unlock()
+
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+type memoryInflight struct {
+	mu       sync.Mutex
+	messages map[*Message]struct{}
+}
+
+func (f *memoryInflight) add(msg *Message) {
+	f.mu.Lock()
+	f.messages[msg] = struct{}{}
+	f.mu.Unlock()
+}
+
+func (f *memoryInflight) remove(msg *Message) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.messages[msg]
+	delete(f.messages, msg)
+	return ok
+}
+
+func (f *memoryInflight) abandon(q *memoryQueue) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	abandoned := len(f.messages)
+	for msg := range f.messages {
+		requeued := *msg
+		requeued.Redelivered = true
+		q.push(requeued)
+		delete(f.messages, msg)
+	}
+	return abandoned
+}
@@ -0,0 +1,175 @@
+package queueclient_test
+
+import (
+	"context"
+	"errors"
+	queueclient "go_project_template/configs/queue_client"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEnvelope(t *testing.T, msgType string) queueclient.Envelope {
+	env, err := queueclient.NewEnvelope(msgType, 1, map[string]string{"email": "user@example.com"})
+	require.NoError(t, err)
+	return env
+}
+
+func startSubscriber(t *testing.T, subscriber queueclient.Subscriber) {
+	go subscriber.Start(context.Background())
+	t.Cleanup(func() { subscriber.Stop() })
+}
+
+func TestMemoryBrokerRouting(t *testing.T) {
+	broker := queueclient.NewMemoryBroker()
+	broker.DeclareQueue("mailQueue", "notification.email.*")
+	broker.DeclareQueue("smsQueue", "notification.sms.*")
+
+	ctx := context.Background()
+	require.NoError(t, broker.Publish(ctx, "notification.email.otp", newEnvelope(t, "email.otp")))
+	require.NoError(t, broker.Publish(ctx, "mailQueue", newEnvelope(t, "email.otp")))
+
+	assert.Equal(t, 2, broker.Pending("mailQueue"))
+	assert.Equal(t, 0, broker.Pending("smsQueue"))
+
+	err := broker.Publish(ctx, "notification.push.alert", newEnvelope(t, "push.alert"))
+	var publishErr *queueclient.PublishError
+	assert.ErrorAs(t, err, &publishErr)
+	assert.ErrorIs(t, err, queueclient.ErrPublishUnroutable)
+}
+
+func TestMemorySubscriberRetriesThenDeadLetters(t *testing.T) {
+	broker := queueclient.NewMemoryBroker()
+
+	var attempts int32
+	handled := make(chan struct{}, 10)
+	subscriber := queueclient.NewMemorySubscriber(
+		queueclient.ConsumerConfig{
+			QueueName:   "mailQueue",
+			BindingKeys: []string{"notification.email.*"},
+			Retry: queueclient.RetryConfig{
+				MaxAttempt:      3,
+				InitialInterval: time.Millisecond,
+			},
+		},
+		func(ctx context.Context, msg queueclient.Message) error {
+			atomic.AddInt32(&attempts, 1)
+			defer func() { handled <- struct{}{} }()
+			return errors.New("smtp unavailable")
+		},
+		broker,
+	)
+	broker.DeclareQueue("mailQueue", "notification.email.*")
+	startSubscriber(t, subscriber)
+
+	require.NoError(t, broker.Publish(context.Background(), "notification.email.otp", newEnvelope(t, "email.otp")))
+
+	for i := 0; i < 3; i++ {
+		<-handled
+	}
+	require.Eventually(t, func() bool { return len(broker.DeadLetters("mailQueue")) == 1 }, time.Second, time.Millisecond)
+
+	deadLetter := broker.DeadLetters("mailQueue")[0]
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal(t, 3, deadLetter.Attempt)
+	assert.Equal(t, "smtp unavailable", deadLetter.Reason)
+}
+
+func TestMemorySubscriberDeadLettersPermanentErrors(t *testing.T) {
+	broker := queueclient.NewMemoryBroker()
+	broker.DeclareQueue("mailQueue")
+
+	router := queueclient.NewRouter()
+	subscriber := queueclient.NewMemorySubscriber(
+		queueclient.ConsumerConfig{
+			QueueName: "mailQueue",
+			Retry:     queueclient.RetryConfig{MaxAttempt: 5, InitialInterval: time.Millisecond},
+		},
+		router.HandlerFunc(),
+		broker,
+	)
+	startSubscriber(t, subscriber)
+
+	require.NoError(t, broker.Publish(context.Background(), "mailQueue", newEnvelope(t, "unknown")))
+
+	require.Eventually(t, func() bool { return len(broker.DeadLetters("mailQueue")) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, broker.DeadLetters("mailQueue")[0].Attempt)
+}
+
+func TestMemorySubscriberRequeuesOnShutdownTimeout(t *testing.T) {
+	broker := queueclient.NewMemoryBroker()
+	broker.DeclareQueue("mailQueue")
+
+	started := make(chan struct{})
+	subscriber := queueclient.NewMemorySubscriber(
+		queueclient.ConsumerConfig{QueueName: "mailQueue", ShutdownTimeout: 10 * time.Millisecond},
+		func(ctx context.Context, msg queueclient.Message) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+		broker,
+	)
+
+	result := make(chan error, 1)
+	go func() { result <- subscriber.Start(context.Background()) }()
+
+	require.NoError(t, broker.Publish(context.Background(), "mailQueue", newEnvelope(t, "email.otp")))
+	<-started
+
+	assert.ErrorIs(t, subscriber.Stop(), queueclient.ErrShutdownTimeout)
+	assert.ErrorIs(t, <-result, queueclient.ErrShutdownTimeout)
+	assert.Equal(t, 1, broker.Pending("mailQueue"))
+}
+
+func TestMemoryBrokerPublishAfter(t *testing.T) {
+	broker := queueclient.NewMemoryBroker()
+	broker.DeclareQueue("mailQueue", "notification.email.*")
+
+	ctx := context.Background()
+	due := newEnvelope(t, "email.trial_ending")
+	cancelled := newEnvelope(t, "email.trial_ending")
+	require.NoError(t, broker.PublishAfter(ctx, "notification.email.trial_ending", due, 20*time.Millisecond))
+	require.NoError(t, broker.PublishAt(ctx, "notification.email.trial_ending", cancelled, time.Now().Add(20*time.Millisecond)))
+
+	assert.Equal(t, 0, broker.Pending("mailQueue"))
+	require.NoError(t, broker.Cancel(ctx, cancelled.ID))
+
+	assert.Eventually(t, func() bool {
+		return broker.Pending("mailQueue") == 1
+	}, time.Second, 5*time.Millisecond)
+
+	assert.ErrorIs(t, broker.Cancel(ctx, due.ID), queueclient.ErrNotScheduled)
+	assert.ErrorIs(t, broker.Cancel(ctx, cancelled.ID), queueclient.ErrNotScheduled)
+}
+
+func TestMemoryBrokerOrdersByPriority(t *testing.T) {
+	broker := queueclient.NewMemoryBroker()
+	broker.DeclareQueue("mailQueue", "notification.email.*")
+
+	ctx := context.Background()
+	for _, priority := range []uint8{1, 9, 1, 5} {
+		env := newEnvelope(t, "email.otp")
+		env.Priority = priority
+		require.NoError(t, broker.Publish(ctx, "notification.email.otp", env))
+	}
+
+	received := make(chan uint8, 4)
+	startSubscriber(t, queueclient.NewMemorySubscriber(
+		queueclient.ConsumerConfig{QueueName: "mailQueue", Concurrency: 1},
+		func(ctx context.Context, msg queueclient.Message) error {
+			received <- msg.Priority
+			return nil
+		},
+		broker,
+	))
+
+	var order []uint8
+	for i := 0; i < 4; i++ {
+		order = append(order, <-received)
+	}
+	assert.Equal(t, []uint8{9, 5, 1, 1}, order)
+}
@@ -0,0 +1,203 @@
+package queueclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	ContentTypeJSON = "application/json"
+
+	headerSchemaVersion = "x-schema-version"
+	headerTenant        = "x-tenant"
+	headerLocale        = "x-locale"
+)
+
+var (
+	ErrUnknownMessageType = errors.New("queueclient: unknown message type")
+	ErrUnsupportedVersion = errors.New("queueclient: unsupported schema version")
+)
+
+// Envelope is the common wrapper of every queue payload. The metadata is
+// carried in AMQP properties and headers, the body is the JSON payload.
+// Priority only orders messages on queues declared with Queue.MaxPriority and
+// between the PriorityLanes of a consumer; higher is more urgent. Locale is
+// the BCP 47 language tag of the recipient, such as "id-ID", for consumers
+// that render content for them.
+type Envelope struct {
+	ID            string
+	Type          string
+	Version       int
+	CreatedAt     time.Time
+	CorrelationID string
+	Tenant        string
+	Locale        string
+	Priority      uint8
+	Payload       json.RawMessage
+}
+
+// NewEnvelope marshals payload and stamps it with a new message ID.
+func NewEnvelope(msgType string, version int, payload interface{}) (Envelope, error) {
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		ID:        uuid.NewString(),
+		Type:      msgType,
+		Version:   version,
+		CreatedAt: time.Now().UTC(),
+		Payload:   body,
+	}, nil
+}
+
+// Decode unmarshals the payload into v.
+func (e Envelope) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+func (e Envelope) publishing() amqp.Publishing {
+	headers := amqp.Table{
+		headerSchemaVersion: int32(e.Version),
+	}
+	if e.Tenant != "" {
+		headers[headerTenant] = e.Tenant
+	}
+	if e.Locale != "" {
+		headers[headerLocale] = e.Locale
+	}
+
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   ContentTypeJSON,
+		MessageId:     e.ID,
+		CorrelationId: e.CorrelationID,
+		Timestamp:     e.CreatedAt,
+		Type:          e.Type,
+		Priority:      e.Priority,
+		Body:          e.Payload,
+	}
+}
+
+// Message is an envelope as received by a consumer.
+type Message struct {
+	Envelope
+	RoutingKey  string
+	Redelivered bool
+	Attempt     int
+}
+
+func messageFromDelivery(d amqp.Delivery) Message {
+	tenant, _ := d.Headers[headerTenant].(string)
+	locale, _ := d.Headers[headerLocale].(string)
+
+	routingKey, ok := d.Headers[headerRoutingKey].(string)
+	if !ok {
+		routingKey = d.RoutingKey
+	}
+
+	return Message{
+		Envelope: Envelope{
+			ID:            d.MessageId,
+			Type:          d.Type,
+			Version:       intHeader(d.Headers, headerSchemaVersion),
+			CreatedAt:     d.Timestamp,
+			CorrelationID: d.CorrelationId,
+			Tenant:        tenant,
+			Locale:        locale,
+			Priority:      d.Priority,
+			Payload:       d.Body,
+		},
+		RoutingKey:  routingKey,
+		Redelivered: d.Redelivered,
+		Attempt:     retryCount(d.Headers) + 1,
+	}
+}
+
+func intHeader(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// HandlerFunc processes one message. Returning an error retries the message
+// unless the error is marked with Permanent.
+type HandlerFunc func(ctx context.Context, msg Message) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not worth retrying; the message goes straight to
+// the dead-letter queue.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Registry dispatches messages to the handler registered for their type and
+// schema version.
+type Registry struct {
+	handlers map[string]map[int]HandlerFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: map[string]map[int]HandlerFunc{},
+	}
+}
+
+func (r *Registry) Register(msgType string, version int, handler HandlerFunc) {
+	if r.handlers[msgType] == nil {
+		r.handlers[msgType] = map[int]HandlerFunc{}
+	}
+	r.handlers[msgType][version] = handler
+}
+
+// Handle implements HandlerFunc. Unknown types and versions are rejected as
+// permanent errors so they are dead-lettered without being retried.
+func (r *Registry) Handle(ctx context.Context, msg Message) error {
+	versions, ok := r.handlers[msg.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("%w: %q", ErrUnknownMessageType, msg.Type))
+	}
+
+	handler, ok := versions[msg.Version]
+	if !ok {
+		return Permanent(fmt.Errorf("%w: %q version %d", ErrUnsupportedVersion, msg.Type, msg.Version))
+	}
+
+	return handler(ctx, msg)
+}
@@ -0,0 +1,72 @@
+package queueclient
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type otpPayload struct {
+	Email   string `json:"email"`
+	OTPCode string `json:"otp_code"`
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	env, err := NewEnvelope("email.otp", 2, otpPayload{Email: "user@example.com", OTPCode: "123456"})
+	require.NoError(t, err)
+	env.CorrelationID = "req-1"
+	env.Tenant = "acme"
+	env.Locale = "id-ID"
+
+	publishing := env.publishing()
+	assert.Equal(t, ContentTypeJSON, publishing.ContentType)
+
+	msg := messageFromDelivery(amqp.Delivery{
+		Headers:       publishing.Headers,
+		ContentType:   publishing.ContentType,
+		MessageId:     publishing.MessageId,
+		CorrelationId: publishing.CorrelationId,
+		Timestamp:     publishing.Timestamp,
+		Type:          publishing.Type,
+		Body:          publishing.Body,
+		RoutingKey:    "notification.email.otp",
+	})
+
+	assert.Equal(t, env, msg.Envelope)
+	assert.Equal(t, "notification.email.otp", msg.RoutingKey)
+	assert.Equal(t, 1, msg.Attempt)
+
+	var payload otpPayload
+	require.NoError(t, msg.Decode(&payload))
+	assert.Equal(t, "123456", payload.OTPCode)
+}
+
+func TestRegistryDispatchesByTypeAndVersion(t *testing.T) {
+	registry := NewRegistry()
+
+	var handled []int
+	registry.Register("email.otp", 1, func(ctx context.Context, msg Message) error {
+		handled = append(handled, 1)
+		return nil
+	})
+	registry.Register("email.otp", 2, func(ctx context.Context, msg Message) error {
+		handled = append(handled, 2)
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(t, registry.Handle(ctx, Message{Envelope: Envelope{Type: "email.otp", Version: 2}}))
+	require.NoError(t, registry.Handle(ctx, Message{Envelope: Envelope{Type: "email.otp", Version: 1}}))
+	assert.Equal(t, []int{2, 1}, handled)
+
+	err := registry.Handle(ctx, Message{Envelope: Envelope{Type: "email.otp", Version: 3}})
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	assert.True(t, IsPermanent(err))
+
+	err = registry.Handle(ctx, Message{Envelope: Envelope{Type: "sms.alert", Version: 1}})
+	assert.ErrorIs(t, err, ErrUnknownMessageType)
+	assert.True(t, IsPermanent(err))
+}
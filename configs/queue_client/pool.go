@@ -0,0 +1,97 @@
+package queueclient
+
+import (
+	"context"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// pooledChannel is a channel in confirm mode together with the notification
+// channels registered on it. A borrowed channel has at most one publishing in
+// flight, so every confirmation read from it belongs to the caller.
+type pooledChannel struct {
+	*amqp091.Channel
+	publish  func(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error
+	confirms chan amqp091.Confirmation
+	returns  chan amqp091.Return
+}
+
+func (pc *pooledChannel) closed() bool {
+	return pc.Channel != nil && pc.Channel.IsClosed()
+}
+
+func (pc *pooledChannel) close() {
+	if pc.Channel != nil {
+		pc.Channel.Close()
+	}
+}
+
+// channelPool hands out at most size channels at a time. Idle channels are
+// kept for reuse, closed ones are dropped and replaced on the next borrow.
+type channelPool struct {
+	open  func() (*pooledChannel, error)
+	idle  chan *pooledChannel
+	slots chan struct{}
+}
+
+func newChannelPool(size int, open func() (*pooledChannel, error)) *channelPool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &channelPool{
+		open:  open,
+		idle:  make(chan *pooledChannel, size),
+		slots: make(chan struct{}, size),
+	}
+}
+
+// get borrows a channel, blocking while every channel is in use.
+func (p *channelPool) get(ctx context.Context) (*pooledChannel, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		select {
+		case pc := <-p.idle:
+			if pc.closed() {
+				continue
+			}
+			return pc, nil
+		default:
+		}
+
+		pc, err := p.open()
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return pc, nil
+	}
+}
+
+// put returns a borrowed channel. Channels whose state is unknown, such as
+// after a confirmation timeout, must be returned with healthy set to false.
+func (p *channelPool) put(pc *pooledChannel, healthy bool) {
+	if healthy && !pc.closed() {
+		p.idle <- pc
+	} else {
+		pc.close()
+	}
+
+	<-p.slots
+}
+
+func (p *channelPool) close() {
+	for {
+		select {
+		case pc := <-p.idle:
+			pc.close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package queueclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeChannelPool(size int, opened *int32) *channelPool {
+	return newChannelPool(size, func() (*pooledChannel, error) {
+		atomic.AddInt32(opened, 1)
+		return &pooledChannel{}, nil
+	})
+}
+
+func TestChannelPoolIsBounded(t *testing.T) {
+	var opened int32
+	pool := newFakeChannelPool(2, &opened)
+
+	first, err := pool.get(context.Background())
+	require.NoError(t, err)
+	_, err = pool.get(context.Background())
+	require.NoError(t, err)
+
+	// Third borrower has to wait for a channel to be returned
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = pool.get(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	pool.put(first, true)
+	third, err := pool.get(context.Background())
+	require.NoError(t, err)
+	assert.Same(t, first, third)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&opened))
+}
+
+func TestChannelPoolDropsUnhealthyChannels(t *testing.T) {
+	var opened int32
+	pool := newFakeChannelPool(1, &opened)
+
+	ch, err := pool.get(context.Background())
+	require.NoError(t, err)
+	pool.put(ch, false)
+
+	next, err := pool.get(context.Background())
+	require.NoError(t, err)
+	assert.NotSame(t, ch, next)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&opened))
+}
+
+func TestChannelPoolReleasesSlotOnOpenError(t *testing.T) {
+	pool := newChannelPool(1, func() (*pooledChannel, error) {
+		return nil, ErrNotConnected
+	})
+
+	_, err := pool.get(context.Background())
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	_, err = pool.get(context.Background())
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
+
+func BenchmarkChannelPoolParallel(b *testing.B) {
+	for _, size := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			var opened int32
+			pool := newFakeChannelPool(size, &opened)
+			ctx := context.Background()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					ch, err := pool.get(ctx)
+					if err != nil {
+						b.Fatal(err)
+					}
+					pool.put(ch, true)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkPublisherPublishParallel measures confirmed publishes against a
+// live broker. It runs only when RABBITMQ_HOST is set, e.g.
+//
+//	RABBITMQ_HOST=localhost RABBITMQ_USER=guest RABBITMQ_PASSWORD=guest \
+//		go test -run=^$ -bench=PublisherPublish ./configs/queue_client
+func BenchmarkPublisherPublishParallel(b *testing.B) {
+	host := os.Getenv("RABBITMQ_HOST")
+	if host == "" {
+		b.Skip("RABBITMQ_HOST is not set")
+	}
+	port, err := strconv.Atoi(os.Getenv("RABBITMQ_PORT"))
+	if err != nil {
+		port = 5672
+	}
+
+	client := NewRabbitMQ(RabbitConfig{
+		Protocol: "amqp",
+		Username: os.Getenv("RABBITMQ_USER"),
+		Password: os.Getenv("RABBITMQ_PASSWORD"),
+		Host:     host,
+		Port:     port,
+	})
+	require.NoError(b, client.Connect())
+	defer client.Close()
+
+	for _, size := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("channels=%d", size), func(b *testing.B) {
+			publisher := NewRabbitPublisher(PublisherConfig{PublisherCount: size}, client)
+			defer publisher.Close()
+
+			queue := fmt.Sprintf("bench.publish.%d", size)
+			require.NoError(b, publisher.QueueDeclare(queue))
+
+			env, err := NewEnvelope("bench", 1, map[string]string{"email": "bench@example.com"})
+			require.NoError(b, err)
+			start := time.Now()
+
+			b.SetParallelism(size)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := publisher.Publish(context.Background(), queue, env); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "msgs/s")
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package queueclient
+
+import (
+	"sort"
+	"sync"
+)
+
+// PriorityLane groups the messages whose Priority is at least MinPriority
+// and below the MinPriority of the next higher lane. When several lanes hold
+// messages, a free worker picks one by smooth weighted round robin, so a lane
+// with Weight 10 is served ten times as often as one with Weight 1 and no
+// lane starves.
+type PriorityLane struct {
+	Name        string
+	MinPriority uint8
+	Weight      int
+}
+
+type lane[T any] struct {
+	PriorityLane
+	items   []T
+	current int
+}
+
+// laneQueue buffers received messages per priority lane for the workers.
+// With capacity > 0, push blocks while that many messages are buffered.
+type laneQueue[T any] struct {
+	mu    sync.Mutex
+	lanes []*lane[T]
+	ready chan struct{}
+	slots chan struct{}
+}
+
+func newLaneQueue[T any](lanes []PriorityLane, capacity int) *laneQueue[T] {
+	if len(lanes) == 0 {
+		lanes = []PriorityLane{{Name: "default", Weight: 1}}
+	}
+
+	q := &laneQueue[T]{
+		ready: make(chan struct{}, 1),
+	}
+	for _, config := range lanes {
+		if config.Weight < 1 {
+			config.Weight = 1
+		}
+		q.lanes = append(q.lanes, &lane[T]{PriorityLane: config})
+	}
+
+	// Highest lane first, a message goes to the first lane it qualifies for
+	sort.SliceStable(q.lanes, func(i, j int) bool {
+		return q.lanes[i].MinPriority > q.lanes[j].MinPriority
+	})
+
+	if capacity > 0 {
+		q.slots = make(chan struct{}, capacity)
+	}
+
+	return q
+}
+
+// push buffers item, waiting for room when the queue is bounded. It returns
+// false when done is closed first.
+func (q *laneQueue[T]) push(priority uint8, item T, done <-chan struct{}) bool {
+	if q.slots != nil {
+		select {
+		case q.slots <- struct{}{}:
+		case <-done:
+			return false
+		}
+	}
+
+	q.mu.Lock()
+	target := q.lanes[len(q.lanes)-1]
+	for _, l := range q.lanes {
+		if priority >= l.MinPriority {
+			target = l
+			break
+		}
+	}
+	target.items = append(target.items, item)
+	q.mu.Unlock()
+
+	q.signal()
+	return true
+}
+
+func (q *laneQueue[T]) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop blocks until an item is available or done is closed. done is checked
+// first, so nothing is picked up once the queue is draining.
+func (q *laneQueue[T]) pop(done <-chan struct{}) (T, bool) {
+	for {
+		select {
+		case <-done:
+			var zero T
+			return zero, false
+		default:
+		}
+
+		if item, more, ok := q.next(); ok {
+			if q.slots != nil {
+				<-q.slots
+			}
+			// Wake up another waiting worker
+			if more {
+				q.signal()
+			}
+			return item, true
+		}
+
+		select {
+		case <-q.ready:
+		case <-done:
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+// next takes an item from the lane chosen by smooth weighted round robin
+// over the non-empty lanes.
+func (q *laneQueue[T]) next() (T, bool, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var best *lane[T]
+	total := 0
+	for _, l := range q.lanes {
+		if len(l.items) == 0 {
+			l.current = 0
+			continue
+		}
+		l.current += l.Weight
+		total += l.Weight
+		if best == nil || l.current > best.current {
+			best = l
+		}
+	}
+
+	if best == nil {
+		var zero T
+		return zero, false, false
+	}
+
+	best.current -= total
+	item := best.items[0]
+	best.items = best.items[1:]
+
+	more := false
+	for _, l := range q.lanes {
+		if len(l.items) > 0 {
+			more = true
+			break
+		}
+	}
+
+	return item, more, true
+}
+
+// drain removes and returns every buffered item.
+func (q *laneQueue[T]) drain() []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []T
+	for _, l := range q.lanes {
+		items = append(items, l.items...)
+		l.items = nil
+		l.current = 0
+	}
+
+	if q.slots != nil {
+		for range items {
+			<-q.slots
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,89 @@
+package queueclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func popAll(t *testing.T, q *laneQueue[string], n int) []string {
+	done := make(chan struct{})
+	items := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		item, ok := q.pop(done)
+		require.True(t, ok)
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestLaneQueueWeightedScheduling(t *testing.T) {
+	q := newLaneQueue[string]([]PriorityLane{
+		{Name: "bulk", MinPriority: 0, Weight: 1},
+		{Name: "transactional", MinPriority: 9, Weight: 10},
+	}, 0)
+
+	for i := 0; i < 20; i++ {
+		q.push(1, "bulk", nil)
+	}
+	for i := 0; i < 20; i++ {
+		q.push(9, "otp", nil)
+	}
+
+	counts := map[string]int{}
+	for _, item := range popAll(t, q, 11) {
+		counts[item]++
+	}
+	assert.Equal(t, map[string]int{"otp": 10, "bulk": 1}, counts)
+
+	// Bulk is served alone once no transactional message is waiting
+	counts = map[string]int{}
+	for _, item := range popAll(t, q, 29) {
+		counts[item]++
+	}
+	assert.Equal(t, map[string]int{"otp": 10, "bulk": 19}, counts)
+}
+
+func TestLaneQueueWithoutLanesIsFIFO(t *testing.T) {
+	q := newLaneQueue[string](nil, 0)
+	q.push(9, "first", nil)
+	q.push(1, "second", nil)
+	q.push(5, "third", nil)
+
+	assert.Equal(t, []string{"first", "second", "third"}, popAll(t, q, 3))
+}
+
+func TestLaneQueueBounded(t *testing.T) {
+	q := newLaneQueue[string](nil, 1)
+	require.True(t, q.push(0, "first", nil))
+
+	done := make(chan struct{})
+	pushed := make(chan bool)
+	go func() { pushed <- q.push(0, "second", done) }()
+
+	select {
+	case <-pushed:
+		t.Fatal("push did not wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.Equal(t, []string{"first"}, popAll(t, q, 1))
+	assert.True(t, <-pushed)
+
+	assert.Equal(t, []string{"second"}, q.drain())
+	assert.True(t, q.push(0, "third", done))
+}
+
+func TestLaneQueuePopStopsWhenDone(t *testing.T) {
+	q := newLaneQueue[string](nil, 0)
+	q.push(0, "buffered", nil)
+
+	done := make(chan struct{})
+	close(done)
+
+	_, ok := q.pop(done)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"buffered"}, q.drain())
+}
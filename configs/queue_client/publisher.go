@@ -1,12 +1,18 @@
 package queueclient
 
 import (
+	"errors"
 	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 	"golang.org/x/net/context"
 )
 
+const defaultConfirmTimeout = 5 * time.Second
+
+// Exchange and Queue must match the options the consumers declare with,
+// otherwise whichever side declares second fails. Persistent publishes with
+// delivery mode 2, so messages on a durable queue survive a broker restart.
 type PublisherConfig struct {
 	ExchangeName   string
 	ExchangeType   string
@@ -14,69 +20,200 @@ type PublisherConfig struct {
 	PuublisherName string
 	PublisherCount int
 	PrefetchCount  int
-	Reconnect      struct {
-		MaxAttempt int
-		Interval   time.Duration
-	}
+	ConfirmTimeout time.Duration
+	Exchange       ExchangeOptions
+	Queue          QueueOptions
+	Persistent     bool
+	Reconnect      ReconnectConfig
+	Stream         StreamConfig
 }
 
-type Publisher struct {
+type RabbitPublisher struct {
 	config PublisherConfig
 	client *RabbitMQ
+	pool   *channelPool
 }
 
-func NewPublisher(config PublisherConfig, client *RabbitMQ) *Publisher {
-	return &Publisher{
+// NewRabbitPublisher creates a publisher that shares up to config.PublisherCount
+// confirm-mode channels between concurrent Publish calls.
+func NewRabbitPublisher(config PublisherConfig, client *RabbitMQ) *RabbitPublisher {
+	p := &RabbitPublisher{
 		config: config,
 		client: client,
 	}
+	p.pool = newChannelPool(config.PublisherCount, p.openChannel)
+
+	return p
 }
 
-func (p *Publisher) QueueDeclare(queue string) error {
-	ch, err := p.client.conn.Channel()
+// ExchangeDeclare declares the exchange the publisher sends to. Publishing to
+// the default exchange ("") needs no declaration.
+func (p *RabbitPublisher) ExchangeDeclare() error {
+	if p.config.ExchangeName == "" {
+		return nil
+	}
+
+	return p.client.Declare(func(ch *amqp091.Channel) error {
+		return declareExchange(ch, p.config.ExchangeName, p.config.ExchangeType, p.config.Exchange)
+	})
+}
+
+// QueueDeclare declares the queue with the configured Queue options and binds
+// it to the exchange with bindingKeys, so messages published before the first
+// consumer starts are not dropped as unroutable.
+func (p *RabbitPublisher) QueueDeclare(queue string, bindingKeys ...string) error {
+	return p.client.Declare(func(ch *amqp091.Channel) error {
+		if err := declareQueue(ch, queue, p.config.Queue); err != nil {
+			return err
+		}
+
+		if p.config.ExchangeName == "" {
+			return nil
+		}
+
+		return bindQueue(ch, queue, p.config.ExchangeName, bindingKeys)
+	})
+}
 
+func (p *RabbitPublisher) openChannel() (*pooledChannel, error) {
+	ch, err := p.client.Channel()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = ch.QueueDeclare(
-		queue, // Queue
-		false, // Durable
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
+	// Put the channel in confirm mode
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
 
-	if err != nil {
-		return err
+	return &pooledChannel{
+		Channel:  ch,
+		publish:  ch.PublishWithContext,
+		confirms: ch.NotifyPublish(make(chan amqp091.Confirmation, 1)),
+		returns:  ch.NotifyReturn(make(chan amqp091.Return, 1)),
+	}, nil
+}
+
+// channel borrows a channel from the pool, waiting for the client to
+// reconnect for up to Reconnect.MaxAttempt intervals when the connection is
+// currently down. A MaxAttempt of zero or less waits until ctx is done or the
+// client is closed.
+func (p *RabbitPublisher) channel(ctx context.Context) (*pooledChannel, error) {
+	for attempt := 0; ; attempt++ {
+		ch, err := p.pool.get(ctx)
+		if err == nil {
+			return ch, nil
+		}
+
+		if errors.Is(err, ErrClientClosed) {
+			return nil, err
+		}
+		if p.config.Reconnect.MaxAttempt > 0 && attempt >= p.config.Reconnect.MaxAttempt {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(p.config.Reconnect.delay()):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Publish sends the envelope to the configured exchange with the given
+// routing key and waits until the broker confirms it. With the default
+// exchange the routing key is the queue name. Every failure is returned as a
+// *PublishError, whether the message could not be sent, was nacked, was
+// returned as unroutable or was not confirmed within ConfirmTimeout.
+func (p *RabbitPublisher) Publish(ctx context.Context, routingKey string, env Envelope) error {
+	msg := env.publishing()
+	if p.config.Persistent {
+		msg.DeliveryMode = amqp091.Persistent
+	}
+
+	if err := p.publish(ctx, routingKey, msg); err != nil {
+		return &PublishError{
+			Exchange:   p.config.ExchangeName,
+			RoutingKey: routingKey,
+			MessageID:  env.ID,
+			Err:        err,
+		}
 	}
 
 	return nil
 }
 
-func (p *Publisher) Publish(ctx context.Context, queue string, data []byte) error {
-	ch, err := p.client.conn.Channel()
-
+// publish sends msg as mandatory on a pooled channel and waits for the
+// confirmation.
+func (p *RabbitPublisher) publish(ctx context.Context, routingKey string, msg amqp091.Publishing) error {
+	ch, err := p.channel(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = ch.PublishWithContext(
+	err = ch.publish(
 		ctx,
-		"",    // Exchange
-		queue, // Queue Name
-		false, // Mandatory
-		false, // Immediate
-		amqp091.Publishing{
-			ContentType: "text/plain",
-			Body:        data,
-		},
+		p.config.ExchangeName, // Exchange
+		routingKey,            // Routing Key
+		true,                  // Mandatory
+		false,                 // Immediate
+		msg,
 	)
 
 	if err != nil {
+		p.pool.put(ch, false)
 		return err
 	}
 
-	return nil
+	err = p.waitForConfirm(ctx, ch.confirms, ch.returns)
+
+	// A late confirmation would be read by the next borrower, so the channel
+	// is only reused when this publishing was settled.
+	p.pool.put(ch, err == nil || errors.Is(err, ErrPublishNacked) || errors.Is(err, ErrPublishUnroutable))
+
+	return err
+}
+
+// waitForConfirm blocks until the broker acks or nacks the last publishing.
+// The broker sends basic.return before basic.ack for an unroutable message,
+// so a return seen first turns the following ack into ErrPublishUnroutable.
+func (p *RabbitPublisher) waitForConfirm(ctx context.Context, confirms <-chan amqp091.Confirmation, returns <-chan amqp091.Return) error {
+	timeout := p.config.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = defaultConfirmTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	unroutable := false
+	for {
+		select {
+		case <-returns:
+			unroutable = true
+		case confirm, ok := <-confirms:
+			if !ok || !confirm.Ack {
+				return ErrPublishNacked
+			}
+			select {
+			case <-returns:
+				unroutable = true
+			default:
+			}
+			if unroutable {
+				return ErrPublishUnroutable
+			}
+			return nil
+		case <-timer.C:
+			return ErrPublishTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close releases the idle channels held by the publisher.
+func (p *RabbitPublisher) Close() {
+	p.pool.close()
 }
@@ -0,0 +1,121 @@
+package queueclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeRabbitPublisher(publish func(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error, opened *int) *RabbitPublisher {
+	return &RabbitPublisher{
+		config: PublisherConfig{ExchangeName: "notification"},
+		pool: newChannelPool(1, func() (*pooledChannel, error) {
+			*opened++
+			confirms := make(chan amqp091.Confirmation, 1)
+			return &pooledChannel{
+				publish: func(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error {
+					if err := publish(ctx, exchange, key, mandatory, immediate, msg); err != nil {
+						return err
+					}
+					confirms <- amqp091.Confirmation{Ack: false}
+					return nil
+				},
+				confirms: confirms,
+				returns:  make(chan amqp091.Return, 1),
+			}, nil
+		}),
+	}
+}
+
+func TestRabbitPublisherWrapsSendErrors(t *testing.T) {
+	sendErr := errors.New("Exception (504) Reason: \"channel/connection is not open\"")
+	opened := 0
+	publisher := newFakeRabbitPublisher(func(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error {
+		return sendErr
+	}, &opened)
+
+	err := publisher.Publish(context.Background(), "email.otp", Envelope{ID: "msg-1"})
+
+	var publishErr *PublishError
+	require.True(t, errors.As(err, &publishErr))
+	assert.Equal(t, "notification", publishErr.Exchange)
+	assert.Equal(t, "email.otp", publishErr.RoutingKey)
+	assert.Equal(t, "msg-1", publishErr.MessageID)
+	assert.ErrorIs(t, err, sendErr)
+
+	// The failed channel is not reused
+	err = publisher.Publish(context.Background(), "email.otp", Envelope{ID: "msg-2"})
+	require.Error(t, err)
+	assert.Equal(t, 2, opened)
+}
+
+func TestRabbitPublisherWrapsNacks(t *testing.T) {
+	opened := 0
+	publisher := newFakeRabbitPublisher(func(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error {
+		assert.True(t, mandatory)
+		assert.Equal(t, "msg-1", msg.MessageId)
+		return nil
+	}, &opened)
+
+	err := publisher.Publish(context.Background(), "email.otp", Envelope{ID: "msg-1"})
+
+	var publishErr *PublishError
+	require.True(t, errors.As(err, &publishErr))
+	assert.Equal(t, "msg-1", publishErr.MessageID)
+	assert.ErrorIs(t, err, ErrPublishNacked)
+}
+
+// newReconnectingPublisher returns a publisher whose channels fail to open
+// with openErr the first failures times.
+func newReconnectingPublisher(reconnect ReconnectConfig, openErr error, failures *int) *RabbitPublisher {
+	return &RabbitPublisher{
+		config: PublisherConfig{ExchangeName: "notification", Reconnect: reconnect},
+		pool: newChannelPool(1, func() (*pooledChannel, error) {
+			if *failures > 0 {
+				*failures--
+				return nil, openErr
+			}
+
+			confirms := make(chan amqp091.Confirmation, 1)
+			return &pooledChannel{
+				publish: func(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error {
+					confirms <- amqp091.Confirmation{Ack: true}
+					return nil
+				},
+				confirms: confirms,
+				returns:  make(chan amqp091.Return, 1),
+			}, nil
+		}),
+	}
+}
+
+func TestRabbitPublisherWaitsForReconnectWithoutMaxAttempt(t *testing.T) {
+	failures := 5
+	publisher := newReconnectingPublisher(ReconnectConfig{Interval: time.Millisecond}, ErrNotConnected, &failures)
+
+	require.NoError(t, publisher.Publish(context.Background(), "email.otp", Envelope{ID: "msg-1"}))
+	assert.Equal(t, 0, failures)
+}
+
+func TestRabbitPublisherGivesUpAfterMaxAttempt(t *testing.T) {
+	failures := 5
+	publisher := newReconnectingPublisher(ReconnectConfig{MaxAttempt: 2, Interval: time.Millisecond}, ErrNotConnected, &failures)
+
+	err := publisher.Publish(context.Background(), "email.otp", Envelope{ID: "msg-1"})
+	assert.ErrorIs(t, err, ErrNotConnected)
+	assert.Equal(t, 2, failures)
+}
+
+func TestRabbitPublisherStopsWaitingWhenClientIsClosed(t *testing.T) {
+	failures := 5
+	publisher := newReconnectingPublisher(ReconnectConfig{Interval: time.Millisecond}, ErrClientClosed, &failures)
+
+	err := publisher.Publish(context.Background(), "email.otp", Envelope{ID: "msg-1"})
+	assert.ErrorIs(t, err, ErrClientClosed)
+	assert.Equal(t, 4, failures)
+}
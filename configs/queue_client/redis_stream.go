@@ -0,0 +1,616 @@
+package queueclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultStreamMaxLen        = 100000
+	defaultStreamClaimMinIdle  = 5 * time.Minute
+	defaultStreamClaimInterval = 30 * time.Second
+
+	streamReadBlock     = 2 * time.Second
+	streamRetryInterval = time.Second
+
+	fieldID            = "id"
+	fieldType          = "type"
+	fieldVersion       = "version"
+	fieldCreatedAt     = "created_at"
+	fieldCorrelationID = "correlation_id"
+	fieldTenant        = "tenant"
+	fieldLocale        = "locale"
+	fieldPriority      = "priority"
+	fieldRoutingKey    = "routing_key"
+	fieldAttempt       = "attempt"
+	fieldPayload       = "payload"
+	fieldFailureReason = "failure_reason"
+	fieldOriginalQueue = "original_queue"
+)
+
+// StreamConfig holds the Redis Streams specific settings. The stream is named
+// after ExchangeName, see streamName.
+//
+// MaxLen caps the stream length (approximately, with XADD MAXLEN ~), so
+// entries that every consumer group has long processed are trimmed. Keep it
+// well above the backlog a group can fall behind by, trimmed entries are
+// lost for groups that did not read them yet.
+//
+// Entries left pending by a crashed consumer are reclaimed with XAUTOCLAIM
+// once they have been idle for ClaimMinIdle, checked every ClaimInterval.
+// ClaimMinIdle has to be longer than the slowest handler or messages are
+// processed twice.
+type StreamConfig struct {
+	MaxLen        int64
+	ClaimMinIdle  time.Duration
+	ClaimInterval time.Duration
+}
+
+func (c StreamConfig) maxLen() int64 {
+	if c.MaxLen <= 0 {
+		return defaultStreamMaxLen
+	}
+	return c.MaxLen
+}
+
+func (c StreamConfig) claimMinIdle() time.Duration {
+	if c.ClaimMinIdle <= 0 {
+		return defaultStreamClaimMinIdle
+	}
+	return c.ClaimMinIdle
+}
+
+func (c StreamConfig) claimInterval() time.Duration {
+	if c.ClaimInterval <= 0 {
+		return defaultStreamClaimInterval
+	}
+	return c.ClaimInterval
+}
+
+func streamValues(msg Message) map[string]interface{} {
+	return map[string]interface{}{
+		fieldID:            msg.ID,
+		fieldType:          msg.Type,
+		fieldVersion:       strconv.Itoa(msg.Version),
+		fieldCreatedAt:     msg.CreatedAt.Format(time.RFC3339Nano),
+		fieldCorrelationID: msg.CorrelationID,
+		fieldTenant:        msg.Tenant,
+		fieldLocale:        msg.Locale,
+		fieldPriority:      strconv.Itoa(int(msg.Priority)),
+		fieldRoutingKey:    msg.RoutingKey,
+		fieldAttempt:       strconv.Itoa(msg.Attempt),
+		fieldPayload:       string(msg.Payload),
+	}
+}
+
+func messageFromStream(values map[string]interface{}) Message {
+	field := func(key string) string {
+		value, _ := values[key].(string)
+		return value
+	}
+
+	version, _ := strconv.Atoi(field(fieldVersion))
+	priority, _ := strconv.ParseUint(field(fieldPriority), 10, 8)
+	createdAt, _ := time.Parse(time.RFC3339Nano, field(fieldCreatedAt))
+
+	attempt, err := strconv.Atoi(field(fieldAttempt))
+	if err != nil || attempt < 1 {
+		attempt = 1
+	}
+
+	return Message{
+		Envelope: Envelope{
+			ID:            field(fieldID),
+			Type:          field(fieldType),
+			Version:       version,
+			CreatedAt:     createdAt,
+			CorrelationID: field(fieldCorrelationID),
+			Tenant:        field(fieldTenant),
+			Locale:        field(fieldLocale),
+			Priority:      uint8(priority),
+			Payload:       json.RawMessage(field(fieldPayload)),
+		},
+		RoutingKey:  field(fieldRoutingKey),
+		Redelivered: attempt > 1,
+		Attempt:     attempt,
+	}
+}
+
+// defaultStream stands in for the default exchange of RabbitMQ. Publishers
+// and consumers without an ExchangeName share it, and a consumer takes the
+// entries whose routing key is its QueueName.
+const defaultStream = "queueclient.default"
+
+func streamName(exchange string) string {
+	if exchange == "" {
+		return defaultStream
+	}
+	return exchange
+}
+
+// Retries of a group are parked in a sorted set scored by their due time and
+// moved to the group's own retry stream once due, so they are not fanned out
+// to the other groups of the main stream.
+func streamRetryName(queue string) string {
+	return queue + ".retry"
+}
+
+func streamDelayedName(queue string) string {
+	return queue + ".retry.delayed"
+}
+
+var promoteRetries = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, member in ipairs(due) do
+	if redis.call('ZREM', KEYS[1], member) == 1 then
+		local args = {}
+		for key, value in pairs(cjson.decode(member)) do
+			table.insert(args, key)
+			table.insert(args, value)
+		end
+		redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], '*', unpack(args))
+	end
+end
+return #due
+`)
+
+// RedisPublisher publishes envelopes to a Redis stream with XADD.
+type RedisPublisher struct {
+	config PublisherConfig
+	client *redis.Client
+}
+
+func NewRedisPublisher(config PublisherConfig, client *redis.Client) *RedisPublisher {
+	return &RedisPublisher{
+		config: config,
+		client: client,
+	}
+}
+
+// Publish appends the envelope to the stream. Unlike RabbitMQ, Redis cannot
+// tell whether any consumer group is interested, so nothing is unroutable.
+func (p *RedisPublisher) Publish(ctx context.Context, routingKey string, env Envelope) error {
+	stream := streamName(p.config.ExchangeName)
+
+	err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: p.config.Stream.maxLen(),
+		Approx: true,
+		Values: streamValues(Message{Envelope: env, RoutingKey: routingKey, Attempt: 1}),
+	}).Err()
+
+	if err != nil {
+		return &PublishError{
+			Exchange:   stream,
+			RoutingKey: routingKey,
+			MessageID:  env.ID,
+			Err:        err,
+		}
+	}
+
+	return nil
+}
+
+// RedisConsumer consumes a Redis stream as a consumer group named after
+// QueueName. Every group receives every entry of the stream, entries whose
+// routing key matches neither the QueueName nor RoutingKey/BindingKeys are
+// acknowledged and skipped. PrefetchCount is the XREADGROUP batch size and
+// the number of entries buffered in the Lanes; Redis has no priority queues,
+// so Exchange, Queue, ConsumerCount and ExchangeType are ignored. After a
+// failed read the consumer waits Reconnect.Interval before reading again.
+type RedisConsumer struct {
+	Config  ConsumerConfig
+	handler HandlerFunc
+	client  *redis.Client
+
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+func NewRedisConsumer(config ConsumerConfig, handler HandlerFunc, client *redis.Client) *RedisConsumer {
+	return &RedisConsumer{
+		Config:  config,
+		handler: handler,
+		client:  client,
+		done:    make(chan struct{}),
+	}
+}
+
+var (
+	_ Publisher  = (*RedisPublisher)(nil)
+	_ Subscriber = (*RedisConsumer)(nil)
+)
+
+type streamDelivery struct {
+	stream string
+	id     string
+	msg    Message
+}
+
+// Start consumes the stream until ctx is cancelled or Stop is called. On
+// shutdown it stops reading and waits up to ShutdownTimeout for in-flight
+// handlers; unfinished entries stay pending and are reclaimed by another
+// consumer of the group.
+func (c *RedisConsumer) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return errors.New("queueclient: consumer already started")
+	}
+	c.started = true
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.mu.Unlock()
+
+	err := c.run(ctx)
+
+	c.mu.Lock()
+	c.cancel()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+
+	return err
+}
+
+func (c *RedisConsumer) streams() (string, string) {
+	return streamName(c.Config.ExchangeName), streamRetryName(c.Config.QueueName)
+}
+
+func (c *RedisConsumer) createGroups(ctx context.Context) error {
+	stream, retryStream := c.streams()
+
+	for _, name := range []string{stream, retryStream} {
+		// Start from the beginning so messages published before the group
+		// existed are not skipped
+		err := c.client.XGroupCreateMkStream(ctx, name, c.Config.QueueName, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *RedisConsumer) run(ctx context.Context) error {
+	if err := c.createGroups(ctx); err != nil {
+		return err
+	}
+
+	consumerName := fmt.Sprintf("%s-%s", c.Config.ConsumerName, uuid.NewString())
+	work := newLaneQueue[streamDelivery](c.Config.Lanes, int(c.batchSize()))
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	var abandoned atomic.Bool
+
+	workers := c.Config.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg *sync.WaitGroup = &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				d, ok := work.pop(ctx.Done())
+				if !ok {
+					return
+				}
+				c.handle(handlerCtx, &abandoned, d)
+			}
+		}()
+	}
+
+	var producers sync.WaitGroup
+	producers.Add(3)
+	go func() {
+		defer producers.Done()
+		c.read(ctx, consumerName, work)
+	}()
+	go func() {
+		defer producers.Done()
+		c.claim(ctx, consumerName, work)
+	}()
+	go func() {
+		defer producers.Done()
+		c.promote(ctx)
+	}()
+
+	<-ctx.Done()
+	producers.Wait()
+
+	// Buffered entries stay pending and are reclaimed once idle
+	work.drain()
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	timeout := c.Config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-finished:
+		c.removeConsumer(consumerName)
+		return nil
+	case <-timer.C:
+		abandoned.Store(true)
+		cancelHandlers()
+		return fmt.Errorf("%w: in-flight entries left pending for reclaim", ErrShutdownTimeout)
+	}
+}
+
+func (c *RedisConsumer) batchSize() int64 {
+	if c.Config.PrefetchCount < 1 {
+		return 10
+	}
+	return int64(c.Config.PrefetchCount)
+}
+
+func (c *RedisConsumer) read(ctx context.Context, consumerName string, work *laneQueue[streamDelivery]) {
+	stream, retryStream := c.streams()
+
+	for ctx.Err() == nil {
+		results, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.Config.QueueName,
+			Consumer: consumerName,
+			Streams:  []string{stream, retryStream, ">", ">"},
+			Count:    c.batchSize(),
+			Block:    streamReadBlock,
+		}).Result()
+
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+
+			log.Println("Failed to read stream:", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.Config.Reconnect.delay()):
+			}
+			continue
+		}
+
+		for _, result := range results {
+			c.dispatch(ctx, result.Stream, result.Messages, work)
+		}
+	}
+}
+
+// claim takes over entries that another consumer of the group read but never
+// acknowledged, typically because it crashed.
+func (c *RedisConsumer) claim(ctx context.Context, consumerName string, work *laneQueue[streamDelivery]) {
+	stream, retryStream := c.streams()
+
+	ticker := time.NewTicker(c.Config.Stream.claimInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, name := range []string{stream, retryStream} {
+			start := "0-0"
+			for ctx.Err() == nil {
+				messages, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+					Stream:   name,
+					Group:    c.Config.QueueName,
+					MinIdle:  c.Config.Stream.claimMinIdle(),
+					Start:    start,
+					Count:    c.batchSize(),
+					Consumer: consumerName,
+				}).Result()
+
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Println("Failed to reclaim pending entries:", err)
+					}
+					break
+				}
+
+				if len(messages) > 0 {
+					log.Printf("Reclaimed %d pending entries from %s", len(messages), name)
+				}
+				c.dispatch(ctx, name, messages, work)
+
+				if next == "0-0" {
+					break
+				}
+				start = next
+			}
+		}
+	}
+}
+
+// promote moves due retries from the delayed set to the retry stream.
+func (c *RedisConsumer) promote(ctx context.Context) {
+	_, retryStream := c.streams()
+	delayed := streamDelayedName(c.Config.QueueName)
+
+	ticker := time.NewTicker(streamRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := promoteRetries.Run(ctx, c.client,
+			[]string{delayed, retryStream},
+			time.Now().UnixMilli(),
+			c.Config.Stream.maxLen(),
+		).Err()
+
+		if err != nil && ctx.Err() == nil {
+			log.Println("Failed to promote retries:", err)
+		}
+	}
+}
+
+func (c *RedisConsumer) dispatch(ctx context.Context, stream string, messages []redis.XMessage, work *laneQueue[streamDelivery]) {
+	keys := bindingKeys(c.Config)
+
+	for _, m := range messages {
+		msg := messageFromStream(m.Values)
+
+		if stream == streamName(c.Config.ExchangeName) && !routes(keys, c.Config.QueueName, msg.RoutingKey) {
+			// Not for this group
+			if err := c.client.XAck(ctx, stream, c.Config.QueueName, m.ID).Err(); err != nil {
+				log.Println("Failed to ack skipped entry:", err)
+			}
+			continue
+		}
+
+		if !work.push(msg.Priority, streamDelivery{stream: stream, id: m.ID, msg: msg}, ctx.Done()) {
+			// Left pending, it is reclaimed once idle
+			return
+		}
+	}
+}
+
+func routes(bindingKeys []string, queue string, routingKey string) bool {
+	if routingKey == queue {
+		return true
+	}
+
+	for _, pattern := range bindingKeys {
+		if MatchRoutingKey(pattern, routingKey) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *RedisConsumer) handle(ctx context.Context, abandoned *atomic.Bool, d streamDelivery) {
+	err := c.handler(ctx, d.msg)
+	if abandoned.Load() {
+		// Shutdown deadline passed, leave the entry pending
+		return
+	}
+
+	if err == nil {
+		if err := c.client.XAck(context.Background(), d.stream, c.Config.QueueName, d.id).Err(); err != nil {
+			log.Println("Failed to ack entry:", err)
+		}
+		return
+	}
+
+	log.Println("Failed to handle message:", err)
+	if err := c.handleFailure(d, err); err != nil {
+		// Left pending, it is reclaimed once idle
+		log.Println("Failed to schedule retry:", err)
+	}
+}
+
+// handleFailure schedules the next attempt or dead-letters the entry, and
+// acknowledges it in the same transaction.
+func (c *RedisConsumer) handleFailure(d streamDelivery, cause error) error {
+	ctx := context.Background()
+	retry := c.Config.Retry
+	queue := c.Config.QueueName
+
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if d.msg.Attempt > retry.maxRetry() || IsPermanent(cause) {
+			values := streamValues(d.msg)
+			values[fieldFailureReason] = cause.Error()
+			values[fieldOriginalQueue] = queue
+
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: deadLetterQueueName(queue),
+				MaxLen: c.Config.Stream.maxLen(),
+				Approx: true,
+				Values: values,
+			})
+		} else {
+			next := d.msg
+			next.Attempt++
+
+			member, err := json.Marshal(streamValues(next))
+			if err != nil {
+				return err
+			}
+
+			pipe.ZAdd(ctx, streamDelayedName(queue), redis.Z{
+				Score:  float64(time.Now().Add(retry.Backoff(d.msg.Attempt)).UnixMilli()),
+				Member: member,
+			})
+		}
+
+		pipe.XAck(ctx, d.stream, queue, d.id)
+		return nil
+	})
+
+	return err
+}
+
+// removeConsumer deletes the consumer from the group after a clean shutdown.
+// It is kept when it still owns pending entries, deleting it would drop them.
+func (c *RedisConsumer) removeConsumer(consumerName string) {
+	ctx := context.Background()
+	stream, retryStream := c.streams()
+
+	for _, name := range []string{stream, retryStream} {
+		pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream:   name,
+			Group:    c.Config.QueueName,
+			Start:    "-",
+			End:      "+",
+			Count:    1,
+			Consumer: consumerName,
+		}).Result()
+
+		if err != nil || len(pending) > 0 {
+			continue
+		}
+
+		if err := c.client.XGroupDelConsumer(ctx, name, c.Config.QueueName, consumerName).Err(); err != nil {
+			log.Println("Failed to remove consumer:", err)
+		}
+	}
+}
+
+// Stop asks a running consumer to drain and waits for Start to return.
+func (c *RedisConsumer) Stop() error {
+	c.mu.Lock()
+	if !c.started {
+		c.mu.Unlock()
+		return nil
+	}
+	c.cancel()
+	c.mu.Unlock()
+
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
@@ -0,0 +1,123 @@
+package queueclient
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamValuesRoundTrip(t *testing.T) {
+	env, err := NewEnvelope("email.otp", 2, otpPayload{Email: "user@example.com", OTPCode: "123456"})
+	require.NoError(t, err)
+	env.CorrelationID = "req-1"
+	env.Tenant = "acme"
+	env.Locale = "id-ID"
+	env.Priority = 9
+
+	values := map[string]interface{}{}
+	for key, value := range streamValues(Message{Envelope: env, RoutingKey: "notification.email.otp", Attempt: 3}) {
+		values[key] = value
+	}
+
+	msg := messageFromStream(values)
+	assert.Equal(t, env.ID, msg.ID)
+	assert.Equal(t, env.Type, msg.Type)
+	assert.Equal(t, env.Version, msg.Version)
+	assert.True(t, env.CreatedAt.Equal(msg.CreatedAt))
+	assert.Equal(t, env.CorrelationID, msg.CorrelationID)
+	assert.Equal(t, env.Tenant, msg.Tenant)
+	assert.Equal(t, env.Locale, msg.Locale)
+	assert.Equal(t, env.Priority, msg.Priority)
+	assert.JSONEq(t, string(env.Payload), string(msg.Payload))
+	assert.Equal(t, "notification.email.otp", msg.RoutingKey)
+	assert.Equal(t, 3, msg.Attempt)
+	assert.True(t, msg.Redelivered)
+}
+
+func TestMessageFromStreamDefaultsAttempt(t *testing.T) {
+	msg := messageFromStream(map[string]interface{}{fieldType: "email.otp"})
+
+	assert.Equal(t, 1, msg.Attempt)
+	assert.False(t, msg.Redelivered)
+}
+
+func TestStreamNameWithoutExchange(t *testing.T) {
+	// Publisher and consumer meet on the same stream whatever the routing key
+	assert.Equal(t, defaultStream, streamName(""))
+	assert.Equal(t, "notification", streamName("notification"))
+
+	// As with the default exchange, the routing key addresses the queue
+	assert.True(t, routes(nil, "mailQueue", "mailQueue"))
+	assert.False(t, routes(nil, "mailQueue", "smsQueue"))
+}
+
+// TestRedisStreamRetriesThenDeadLetters needs a live Redis server. It runs
+// only when REDIS_HOST is set, e.g.
+//
+//	REDIS_HOST=localhost:6379 go test -run=RedisStream ./configs/queue_client
+func TestRedisStreamRetriesThenDeadLetters(t *testing.T) {
+	host := os.Getenv("REDIS_HOST")
+	if host == "" {
+		t.Skip("REDIS_HOST is not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: host, Password: os.Getenv("REDIS_PASSWORD")})
+	defer client.Close()
+
+	exchange := "test.notification." + uuid.NewString()
+	queue := "test.mailQueue." + uuid.NewString()
+	defer client.Del(context.Background(),
+		exchange, streamRetryName(queue), streamDelayedName(queue), deadLetterQueueName(queue))
+
+	attempts := make(chan Message, 3)
+	consumer := NewRedisConsumer(
+		ConsumerConfig{
+			ExchangeName:    exchange,
+			BindingKeys:     []string{"notification.email.*"},
+			QueueName:       queue,
+			ConsumerName:    "test",
+			Concurrency:     2,
+			ShutdownTimeout: time.Second,
+			Retry:           RetryConfig{MaxAttempt: 2, InitialInterval: 10 * time.Millisecond},
+		},
+		func(ctx context.Context, msg Message) error {
+			attempts <- msg
+			return errors.New("smtp unavailable")
+		},
+		client,
+	)
+
+	result := make(chan error, 1)
+	go func() { result <- consumer.Start(context.Background()) }()
+	defer consumer.Stop()
+
+	publisher := NewRedisPublisher(PublisherConfig{ExchangeName: exchange}, client)
+	for _, key := range []string{"notification.sms.alert", "notification.email.otp"} {
+		env, err := NewEnvelope("email.otp", 1, otpPayload{Email: "user@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, publisher.Publish(context.Background(), key, env))
+	}
+
+	first := <-attempts
+	assert.Equal(t, "notification.email.otp", first.RoutingKey)
+	assert.Equal(t, 1, first.Attempt)
+
+	second := <-attempts
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, 2, second.Attempt)
+
+	assert.Eventually(t, func() bool {
+		return client.XLen(context.Background(), deadLetterQueueName(queue)).Val() == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, consumer.Stop())
+	require.NoError(t, <-result)
+	assert.Empty(t, attempts)
+}
@@ -0,0 +1,147 @@
+package queueclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	headerRetryCount    = "x-retry-count"
+	headerAttemptCount  = "x-attempt-count"
+	headerFailureReason = "x-failure-reason"
+	headerOriginalQueue = "x-original-queue"
+	headerRoutingKey    = "x-original-routing-key"
+)
+
+// RetryConfig controls how failed deliveries are retried before they are
+// routed to the dead-letter queue. MaxAttempt counts every handler call,
+// including the first one, so MaxAttempt 1 disables retries.
+type RetryConfig struct {
+	MaxAttempt      int
+	InitialInterval time.Duration
+	Multiplier      float64
+	MaxInterval     time.Duration
+}
+
+// Backoff returns the delay before the given retry (starting at 1).
+func (r RetryConfig) Backoff(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(r.InitialInterval) * math.Pow(multiplier, float64(retry-1))
+	if r.MaxInterval > 0 && delay > float64(r.MaxInterval) {
+		return r.MaxInterval
+	}
+
+	return time.Duration(delay)
+}
+
+func (r RetryConfig) maxRetry() int {
+	if r.MaxAttempt < 1 {
+		return 0
+	}
+	return r.MaxAttempt - 1
+}
+
+func retryQueueName(queue string, retry int) string {
+	return fmt.Sprintf("%s.retry.%d", queue, retry)
+}
+
+func deadLetterQueueName(queue string) string {
+	return queue + ".dlq"
+}
+
+// declareRetryTopology declares one delay queue per retry and the dead-letter
+// queue. Delay queues hold a message for their TTL and then dead-letter it
+// back to the work queue through the default exchange.
+func declareRetryTopology(ch amqpChannel, queue string, retry RetryConfig, durable bool) error {
+	for i := 1; i <= retry.maxRetry(); i++ {
+		if _, err := ch.QueueDeclare(
+			retryQueueName(queue, i), // Name
+			durable,                  // Durable
+			false,                    // Auto delete
+			false,                    // Exclusive
+			false,                    // No Wait
+			amqp.Table{
+				"x-message-ttl":             retry.Backoff(i).Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	return declareDeadLetterQueue(ch, queue, durable)
+}
+
+// retryCount reads the number of retries already done for a delivery.
+func retryCount(headers amqp.Table) int {
+	return intHeader(headers, headerRetryCount)
+}
+
+// republisher sends failed deliveries to the delay and dead-letter queues
+// through the default exchange. publish returns once the broker confirmed
+// the message, see RabbitPublisher.
+type republisher interface {
+	publish(ctx context.Context, routingKey string, msg amqp.Publishing) error
+	Close()
+}
+
+// handleFailure moves a failed delivery to the next delay queue, or to the
+// dead-letter queue once every attempt is used or the error is permanent.
+// The original is only acked after the broker confirmed the republish and
+// requeued otherwise, so a dropped or unroutable republish loses nothing.
+func handleFailure(ctx context.Context, retries republisher, queue string, retry RetryConfig, msg amqp.Delivery, cause error) error {
+	retried := retryCount(msg.Headers)
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	// Republishing through the default exchange replaces the routing key
+	if _, ok := headers[headerRoutingKey]; !ok {
+		headers[headerRoutingKey] = msg.RoutingKey
+	}
+
+	routingKey := deadLetterQueueName(queue)
+	if retried < retry.maxRetry() && !IsPermanent(cause) {
+		routingKey = retryQueueName(queue, retried+1)
+		headers[headerRetryCount] = int32(retried + 1)
+	} else {
+		headers[headerAttemptCount] = int32(retried + 1)
+		headers[headerFailureReason] = cause.Error()
+		headers[headerOriginalQueue] = queue
+	}
+
+	err := retries.publish(ctx, routingKey, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  msg.DeliveryMode,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+		Priority:      msg.Priority,
+		Body:          msg.Body,
+	})
+
+	if err != nil {
+		if nackErr := msg.Nack(false, true); nackErr != nil {
+			return nackErr
+		}
+		return fmt.Errorf("queueclient: republish to %q: %w", routingKey, err)
+	}
+
+	return msg.Ack(false)
+}
@@ -0,0 +1,127 @@
+package queueclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	retry := RetryConfig{
+		MaxAttempt:      5,
+		InitialInterval: time.Second,
+		Multiplier:      2,
+		MaxInterval:     5 * time.Second,
+	}
+
+	assert.Equal(t, time.Second, retry.Backoff(1))
+	assert.Equal(t, 2*time.Second, retry.Backoff(2))
+	assert.Equal(t, 4*time.Second, retry.Backoff(3))
+	// Capped by MaxInterval
+	assert.Equal(t, 5*time.Second, retry.Backoff(4))
+}
+
+func TestRetryBackoffDefaultMultiplier(t *testing.T) {
+	retry := RetryConfig{
+		MaxAttempt:      3,
+		InitialInterval: 100 * time.Millisecond,
+	}
+
+	assert.Equal(t, 100*time.Millisecond, retry.Backoff(0))
+	assert.Equal(t, 200*time.Millisecond, retry.Backoff(2))
+}
+
+// failDelivery runs a failing handler on one delivery with the given retry
+// headers and returns the broker it was settled on.
+func failDelivery(t *testing.T, headers amqp.Table, cause error) *fakeBroker {
+	broker := newFakeBroker(0)
+	consumer := newFakeConsumer(broker, time.Second, func(ctx context.Context, msg Message) error {
+		return cause
+	})
+	consumer.Config.Retry = RetryConfig{MaxAttempt: 3, InitialInterval: time.Second}
+
+	running := &inflight{deliveries: map[deliveryKey]amqp.Delivery{}}
+	consumer.handle(context.Background(), running, delivery{
+		sub: &subscription{ch: broker},
+		msg: amqp.Delivery{
+			Acknowledger: broker,
+			DeliveryTag:  1,
+			Headers:      headers,
+			RoutingKey:   "notification.email.otp",
+			MessageId:    "msg-1",
+			Type:         "email.otp",
+			Body:         []byte(`{"otp_code":"123456"}`),
+		},
+	})
+
+	return broker
+}
+
+func TestHandlerFailureIsRetried(t *testing.T) {
+	broker := failDelivery(t, nil, errors.New("smtp: connection refused"))
+
+	require.Equal(t, []string{"mailQueue.retry.1"}, broker.publishTo)
+	published := broker.published[0]
+	assert.Equal(t, int32(1), published.Headers[headerRetryCount])
+	assert.Equal(t, "notification.email.otp", published.Headers[headerRoutingKey])
+	assert.Equal(t, "msg-1", published.MessageId)
+	assert.Equal(t, []byte(`{"otp_code":"123456"}`), published.Body)
+
+	acked, requeued := broker.settled()
+	assert.Equal(t, []uint64{1}, acked)
+	assert.Empty(t, requeued)
+}
+
+func TestHandlerFailureIncrementsRetryCount(t *testing.T) {
+	broker := failDelivery(t, amqp.Table{
+		headerRetryCount: int32(1),
+		headerRoutingKey: "notification.email.otp",
+	}, errors.New("smtp: connection refused"))
+
+	require.Equal(t, []string{"mailQueue.retry.2"}, broker.publishTo)
+	assert.Equal(t, int32(2), broker.published[0].Headers[headerRetryCount])
+}
+
+func TestHandlerFailureIsDeadLetteredAtMaxAttempt(t *testing.T) {
+	broker := failDelivery(t, amqp.Table{headerRetryCount: int32(2)}, errors.New("smtp: connection refused"))
+
+	require.Equal(t, []string{"mailQueue.dlq"}, broker.publishTo)
+	headers := broker.published[0].Headers
+	assert.Equal(t, int32(3), headers[headerAttemptCount])
+	assert.Equal(t, "smtp: connection refused", headers[headerFailureReason])
+	assert.Equal(t, "mailQueue", headers[headerOriginalQueue])
+	assert.Equal(t, "notification.email.otp", headers[headerRoutingKey])
+
+	acked, _ := broker.settled()
+	assert.Equal(t, []uint64{1}, acked)
+}
+
+func TestPermanentFailureSkipsRetries(t *testing.T) {
+	broker := failDelivery(t, nil, Permanent(errors.New("invalid payload")))
+
+	require.Equal(t, []string{"mailQueue.dlq"}, broker.publishTo)
+	headers := broker.published[0].Headers
+	assert.Equal(t, int32(1), headers[headerAttemptCount])
+	assert.Equal(t, "invalid payload", headers[headerFailureReason])
+	assert.NotContains(t, headers, headerRetryCount)
+}
+
+func TestHandlerFailureRequeuesWhenRepublishIsNotConfirmed(t *testing.T) {
+	broker := newFakeBroker(0)
+	broker.publishErr = &PublishError{RoutingKey: "mailQueue.retry.1", Err: ErrPublishUnroutable}
+
+	err := handleFailure(context.Background(), fakeRepublisher{broker}, "mailQueue", RetryConfig{MaxAttempt: 3}, amqp.Delivery{
+		Acknowledger: broker,
+		DeliveryTag:  1,
+	}, errors.New("smtp: connection refused"))
+
+	assert.ErrorIs(t, err, ErrPublishUnroutable)
+	acked, requeued := broker.settled()
+	assert.Empty(t, acked)
+	assert.Equal(t, []uint64{1}, requeued)
+}
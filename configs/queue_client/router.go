@@ -0,0 +1,174 @@
+package queueclient
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a HandlerFunc, e.g. to log, recover or time it.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type keyRoute struct {
+	pattern string
+	handler HandlerFunc
+}
+
+// Router dispatches a message by its type and schema version first and falls
+// back to the routing key patterns registered with HandleKey. Patterns use
+// the AMQP topic syntax: "*" matches one word and "#" zero or more.
+type Router struct {
+	registry    *Registry
+	keys        []keyRoute
+	middlewares []Middleware
+}
+
+func NewRouter() *Router {
+	return &Router{
+		registry: NewRegistry(),
+	}
+}
+
+// Use appends middlewares; the first one added is the outermost.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+func (r *Router) Handle(msgType string, version int, handler HandlerFunc) {
+	r.registry.Register(msgType, version, handler)
+}
+
+func (r *Router) HandleKey(pattern string, handler HandlerFunc) {
+	r.keys = append(r.keys, keyRoute{pattern: pattern, handler: handler})
+}
+
+// HandlerFunc returns the router with its middlewares applied, ready to be
+// passed to NewRabbitConsumer.
+func (r *Router) HandlerFunc() HandlerFunc {
+	handler := r.dispatch
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+
+	return handler
+}
+
+func (r *Router) dispatch(ctx context.Context, msg Message) error {
+	if _, ok := r.registry.handlers[msg.Type]; ok {
+		return r.registry.Handle(ctx, msg)
+	}
+
+	for _, route := range r.keys {
+		if MatchRoutingKey(route.pattern, msg.RoutingKey) {
+			return route.handler(ctx, msg)
+		}
+	}
+
+	return r.registry.Handle(ctx, msg)
+}
+
+// MatchRoutingKey reports whether key matches a topic exchange pattern.
+func MatchRoutingKey(pattern string, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern []string, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && matchWords(pattern[1:], key[1:])
+	}
+}
+
+// Logging logs every message with its outcome and duration.
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			if err != nil {
+				log.Printf("[queue] %s v%d id=%s attempt=%d failed after %s: %s", msg.Type, msg.Version, msg.ID, msg.Attempt, time.Since(start), err)
+				return err
+			}
+
+			log.Printf("[queue] %s v%d id=%s handled in %s", msg.Type, msg.Version, msg.ID, time.Since(start))
+			return nil
+		}
+	}
+}
+
+// Recovery turns a panicking handler into a failed message instead of
+// crashing the consumer process.
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[queue] panic while handling %s id=%s: %v\n%s", msg.Type, msg.ID, r, debug.Stack())
+					err = fmt.Errorf("queueclient: handler panicked: %v", r)
+				}
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Timeout cancels the handler context after d.
+func Timeout(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Metrics counts handled and failed messages and the total handling time per
+// message type, published through expvar under the given name.
+func Metrics(name string) Middleware {
+	handled := expvarMap(name + ".handled")
+	failed := expvarMap(name + ".failed")
+	duration := expvarMap(name + ".duration_ms")
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			duration.Add(msg.Type, time.Since(start).Milliseconds())
+			if err != nil {
+				failed.Add(msg.Type, 1)
+				return err
+			}
+
+			handled.Add(msg.Type, 1)
+			return nil
+		}
+	}
+}
+
+func expvarMap(name string) *expvar.Map {
+	if m, ok := expvar.Get(name).(*expvar.Map); ok {
+		return m
+	}
+	return expvar.NewMap(name)
+}
@@ -0,0 +1,89 @@
+package queueclient_test
+
+import (
+	"context"
+	"errors"
+	queueclient "go_project_template/configs/queue_client"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchRoutingKey(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"notification.email.otp", "notification.email.otp", true},
+		{"notification.email.*", "notification.email.otp", true},
+		{"notification.email.*", "notification.email.otp.v2", false},
+		{"notification.*.alert", "notification.sms.alert", true},
+		{"notification.#", "notification", true},
+		{"notification.#", "notification.email.otp", true},
+		{"#.alert", "notification.sms.alert", true},
+		{"notification.sms.*", "notification.email.otp", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.match, queueclient.MatchRoutingKey(c.pattern, c.key), "%s ~ %s", c.pattern, c.key)
+	}
+}
+
+func TestRouterDispatch(t *testing.T) {
+	router := queueclient.NewRouter()
+
+	var got string
+	router.Handle("email.otp", 1, func(ctx context.Context, msg queueclient.Message) error {
+		got = "otp"
+		return nil
+	})
+	router.HandleKey("notification.sms.*", func(ctx context.Context, msg queueclient.Message) error {
+		got = "sms"
+		return nil
+	})
+	handler := router.HandlerFunc()
+
+	ctx := context.Background()
+	require.NoError(t, handler(ctx, queueclient.Message{Envelope: queueclient.Envelope{Type: "email.otp", Version: 1}}))
+	assert.Equal(t, "otp", got)
+
+	require.NoError(t, handler(ctx, queueclient.Message{Envelope: queueclient.Envelope{Type: "sms.alert"}, RoutingKey: "notification.sms.alert"}))
+	assert.Equal(t, "sms", got)
+
+	err := handler(ctx, queueclient.Message{Envelope: queueclient.Envelope{Type: "push.alert"}, RoutingKey: "notification.push.alert"})
+	assert.ErrorIs(t, err, queueclient.ErrUnknownMessageType)
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	router := queueclient.NewRouter()
+
+	var order []string
+	trace := func(name string) queueclient.Middleware {
+		return func(next queueclient.HandlerFunc) queueclient.HandlerFunc {
+			return func(ctx context.Context, msg queueclient.Message) error {
+				order = append(order, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+	router.Use(queueclient.Recovery(), trace("outer"), trace("inner"), queueclient.Timeout(10*time.Millisecond))
+
+	router.Handle("panic", 1, func(ctx context.Context, msg queueclient.Message) error {
+		panic("boom")
+	})
+	router.Handle("slow", 1, func(ctx context.Context, msg queueclient.Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	handler := router.HandlerFunc()
+
+	err := handler(context.Background(), queueclient.Message{Envelope: queueclient.Envelope{Type: "panic", Version: 1}})
+	assert.ErrorContains(t, err, "panicked")
+	assert.Equal(t, []string{"outer", "inner"}, order)
+
+	err = handler(context.Background(), queueclient.Message{Envelope: queueclient.Envelope{Type: "slow", Version: 1}})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,180 @@
+package queueclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	QueueTypeClassic = "classic"
+	QueueTypeQuorum  = "quorum"
+
+	OverflowDropHead         = "drop-head"
+	OverflowRejectPublish    = "reject-publish"
+	OverflowRejectPublishDLX = "reject-publish-dlx"
+)
+
+var ErrInvalidTopology = errors.New("queueclient: invalid topology")
+
+// ExchangeOptions describes how an exchange is declared. A durable exchange
+// survives a broker restart.
+type ExchangeOptions struct {
+	Durable    bool
+	AutoDelete bool
+}
+
+// QueueOptions describes how a queue is declared. RabbitMQ refuses to
+// redeclare an existing queue with different options (PRECONDITION_FAILED),
+// so every producer and consumer declaring the same queue has to share one
+// QueueOptions value; changing it requires deleting the queue first.
+//
+// Durable queues survive a broker restart, but only keep the messages that
+// were published as persistent. MessageTTL, MaxLength and MaxLengthBytes
+// bound how long and how many messages are kept, Overflow decides what
+// happens at the limit: drop the oldest (the default) or reject new
+// publishes, which makes a confirming publisher fail instead of silently
+// losing mail. With DeadLetter, expired and dropped messages are moved to
+// the <queue>.dlq queue instead of being discarded.
+//
+// Quorum queues are replicated and have to be durable; they support neither
+// MaxPriority nor exclusive or auto-delete queues.
+type QueueOptions struct {
+	Durable        bool
+	AutoDelete     bool
+	Exclusive      bool
+	Type           string
+	MessageTTL     time.Duration
+	MaxLength      int64
+	MaxLengthBytes int64
+	Overflow       string
+	DeadLetter     bool
+	MaxPriority    uint8
+}
+
+func (o QueueOptions) validate() error {
+	switch o.Type {
+	case "", QueueTypeClassic:
+	case QueueTypeQuorum:
+		if !o.Durable || o.AutoDelete || o.Exclusive {
+			return fmt.Errorf("%w: quorum queues must be durable, not exclusive and not auto-delete", ErrInvalidTopology)
+		}
+		if o.MaxPriority > 0 {
+			return fmt.Errorf("%w: quorum queues do not support MaxPriority", ErrInvalidTopology)
+		}
+	default:
+		return fmt.Errorf("%w: unknown queue type %q", ErrInvalidTopology, o.Type)
+	}
+
+	switch o.Overflow {
+	case "", OverflowDropHead, OverflowRejectPublish:
+	case OverflowRejectPublishDLX:
+		if !o.DeadLetter {
+			return fmt.Errorf("%w: overflow %q needs DeadLetter", ErrInvalidTopology, o.Overflow)
+		}
+	default:
+		return fmt.Errorf("%w: unknown overflow %q", ErrInvalidTopology, o.Overflow)
+	}
+
+	return nil
+}
+
+func (o QueueOptions) arguments(queue string) amqp.Table {
+	args := amqp.Table{}
+
+	if o.Type != "" {
+		args["x-queue-type"] = o.Type
+	}
+	if o.MessageTTL > 0 {
+		args["x-message-ttl"] = o.MessageTTL.Milliseconds()
+	}
+	if o.MaxLength > 0 {
+		args["x-max-length"] = o.MaxLength
+	}
+	if o.MaxLengthBytes > 0 {
+		args["x-max-length-bytes"] = o.MaxLengthBytes
+	}
+	if o.Overflow != "" {
+		args["x-overflow"] = o.Overflow
+	}
+	if o.DeadLetter {
+		args["x-dead-letter-exchange"] = ""
+		args["x-dead-letter-routing-key"] = deadLetterQueueName(queue)
+	}
+	if o.MaxPriority > 0 {
+		args["x-max-priority"] = int32(o.MaxPriority)
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+func declareExchange(ch amqpChannel, name string, kind string, options ExchangeOptions) error {
+	return ch.ExchangeDeclare(
+		name,               // Name
+		kind,               // Type
+		options.Durable,    // Durable
+		options.AutoDelete, // Auto delete
+		false,              // Internal
+		false,              // No Wait
+		nil,                // Arguments
+	)
+}
+
+// declareQueue declares the queue, and its dead-letter queue first when the
+// queue dead-letters to it.
+func declareQueue(ch amqpChannel, name string, options QueueOptions) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	if options.DeadLetter {
+		if err := declareDeadLetterQueue(ch, name, options.Durable); err != nil {
+			return err
+		}
+	}
+
+	_, err := ch.QueueDeclare(
+		name,                    // Name
+		options.Durable,         // Durable
+		options.AutoDelete,      // Auto delete
+		options.Exclusive,       // Exclusive
+		false,                   // No Wait
+		options.arguments(name), // Arguments
+	)
+
+	return err
+}
+
+func declareDeadLetterQueue(ch amqpChannel, queue string, durable bool) error {
+	_, err := ch.QueueDeclare(
+		deadLetterQueueName(queue), // Name
+		durable,                    // Durable
+		false,                      // Auto delete
+		false,                      // Exclusive
+		false,                      // No Wait
+		nil,                        // Arguments
+	)
+
+	return err
+}
+
+func bindQueue(ch amqpChannel, queue string, exchange string, keys []string) error {
+	for _, key := range keys {
+		if err := ch.QueueBind(
+			queue,    // Queue Name
+			key,      // Routing Key
+			exchange, // Exchange
+			false,    // No Wait
+			nil,      // Arguments
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
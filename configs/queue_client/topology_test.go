@@ -0,0 +1,86 @@
+package queueclient
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueOptionsArguments(t *testing.T) {
+	options := QueueOptions{
+		Durable:        true,
+		Type:           QueueTypeClassic,
+		MessageTTL:     time.Hour,
+		MaxLength:      1000,
+		MaxLengthBytes: 1 << 20,
+		Overflow:       OverflowRejectPublish,
+		DeadLetter:     true,
+		MaxPriority:    10,
+	}
+
+	assert.Equal(t, amqp.Table{
+		"x-queue-type":              QueueTypeClassic,
+		"x-message-ttl":             int64(3600000),
+		"x-max-length":              int64(1000),
+		"x-max-length-bytes":        int64(1 << 20),
+		"x-overflow":                OverflowRejectPublish,
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": "mailQueue.dlq",
+		"x-max-priority":            int32(10),
+	}, options.arguments("mailQueue"))
+
+	assert.Nil(t, QueueOptions{Durable: true}.arguments("mailQueue"))
+}
+
+func TestQueueOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options QueueOptions
+		valid   bool
+	}{
+		{"zero value", QueueOptions{}, true},
+		{"durable quorum", QueueOptions{Durable: true, Type: QueueTypeQuorum}, true},
+		{"transient quorum", QueueOptions{Type: QueueTypeQuorum}, false},
+		{"exclusive quorum", QueueOptions{Durable: true, Exclusive: true, Type: QueueTypeQuorum}, false},
+		{"quorum with priority", QueueOptions{Durable: true, Type: QueueTypeQuorum, MaxPriority: 10}, false},
+		{"unknown type", QueueOptions{Type: "stream"}, false},
+		{"unknown overflow", QueueOptions{Overflow: "drop-tail"}, false},
+		{"reject-publish-dlx without dead letter", QueueOptions{Overflow: OverflowRejectPublishDLX}, false},
+		{"reject-publish-dlx with dead letter", QueueOptions{Overflow: OverflowRejectPublishDLX, DeadLetter: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidTopology)
+			}
+		})
+	}
+}
+
+func TestDeclareQueueDeclaresDeadLetterQueueFirst(t *testing.T) {
+	broker := newFakeBroker(0)
+
+	require.NoError(t, declareQueue(broker, "mailQueue", QueueOptions{Durable: true, DeadLetter: true}))
+
+	require.Len(t, broker.queues, 2)
+	assert.Equal(t, "mailQueue.dlq", broker.queues[0].name)
+	assert.True(t, broker.queues[0].durable)
+	assert.Equal(t, "mailQueue", broker.queues[1].name)
+	assert.True(t, broker.queues[1].durable)
+}
+
+func TestDeclareQueueRejectsInvalidOptions(t *testing.T) {
+	broker := newFakeBroker(0)
+
+	err := declareQueue(broker, "mailQueue", QueueOptions{Type: QueueTypeQuorum})
+
+	assert.ErrorIs(t, err, ErrInvalidTopology)
+	assert.Empty(t, broker.queues)
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"go_project_template/internal/exception"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ErrInvalidAPIKey = errors.New("auth: missing or invalid API key")
+
+// RequireAPIKey rejects requests that do not carry
+// "Authorization: Bearer <key>".
+func RequireAPIKey(key string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !ok || key == "" || subtle.ConstantTimeCompare([]byte(token), []byte(key)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, exception.NewHttpError(http.StatusUnauthorized, "Unauthorized", ErrInvalidAPIKey))
+			return
+		}
+
+		ctx.Next()
+	}
+}
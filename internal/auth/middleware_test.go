@@ -0,0 +1,44 @@
+package auth_test
+
+import (
+	"go_project_template/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/templates", auth.RequireAPIKey("secret"), func(ctx *gin.Context) {
+		ctx.Status(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"valid key", "Bearer secret", http.StatusCreated},
+		{"wrong key", "Bearer guess", http.StatusUnauthorized},
+		{"missing header", "", http.StatusUnauthorized},
+		{"other scheme", "Basic secret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/templates", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
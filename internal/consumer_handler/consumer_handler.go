@@ -1,35 +1,41 @@
 package consumerhandler
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	queueclient "go_project_template/configs/queue_client"
 	"go_project_template/internal/mail"
+	"go_project_template/internal/template"
 	"go_project_template/internal/user/model"
-	"html/template"
 	"log"
-	"path"
 )
 
 type IConsumerHandler interface {
-	SendEmail(ctx context.Context, data []byte) error
+	SendEmail(ctx context.Context, msg queueclient.Message) error
 }
 
 type ConsumerHandler struct {
-	sender mail.EmailSender
+	sender    mail.EmailSender
+	templates *template.Registry
+	published template.Source
 }
 
-func NewConsumerHandler(sender mail.EmailSender) *ConsumerHandler {
+// NewConsumerHandler renders emails from templates, preferring the versions
+// published through the template API when published is not nil.
+func NewConsumerHandler(sender mail.EmailSender, templates *template.Registry, published template.Source) *ConsumerHandler {
 	return &ConsumerHandler{
-		sender: sender,
+		sender:    sender,
+		templates: templates,
+		published: published,
 	}
 }
 
-func (ch *ConsumerHandler) SendEmail(ctx context.Context, data []byte) error {
+func (ch *ConsumerHandler) SendEmail(ctx context.Context, msg queueclient.Message) error {
 	var userOTPVerificationEmailContent model.OTPVerificationEmailContent
 
-	if err := json.Unmarshal(data, &userOTPVerificationEmailContent); err != nil {
-		return err
+	// A payload that cannot be decoded will never succeed on retry
+	if err := msg.Decode(&userOTPVerificationEmailContent); err != nil {
+		return queueclient.Permanent(err)
 	}
 
 	log.Println("Sending OTP Code to", userOTPVerificationEmailContent.Email)
@@ -37,45 +43,35 @@ func (ch *ConsumerHandler) SendEmail(ctx context.Context, data []byte) error {
 	// content := fmt.Sprintf(`Your OTP Code is %s or click <a href="%s">here</a>`, userOTPVerificationEmailContent.OTPCode, userOTPVerificationEmailContent.Url)
 
 	temp := map[string]interface{}{
-		"Product": "Mata Duitan",
 		"OTPCode": userOTPVerificationEmailContent.OTPCode,
 		"URL":     userOTPVerificationEmailContent.Url,
 	}
-	content, err := RenderTemplate(temp)
+	content, err := ch.templates.RenderFrom(ctx, ch.published, "confirm-email", msg.Locale, temp)
 
 	if err != nil {
+		// Retrying cannot bring back a template or translation missing from
+		// the binary
+		if errors.Is(err, template.ErrTemplateNotFound) || errors.Is(err, template.ErrMissingTranslation) {
+			return queueclient.Permanent(err)
+		}
 		return err
 	}
 
 	if err := ch.sender.SendEmail(
-		"OTP Request",
-		content,
+		ctx,
+		content.Subject,
+		mail.Body{Text: content.Text, HTML: content.HTML},
 		[]string{userOTPVerificationEmailContent.Email},
-		[]string{},
-		[]string{},
-		[]string{},
+		nil,
+		nil,
+		nil,
 	); err != nil {
+		// An oversized or broken attachment fails the same way on every retry
+		if errors.Is(err, mail.ErrAttachmentTooLarge) || errors.Is(err, mail.ErrInvalidAttachment) {
+			return queueclient.Permanent(err)
+		}
 		return err
 	}
 
 	return nil
 }
-
-func RenderTemplate(data map[string]interface{}) (string, error) {
-	filepath := path.Join("/home/ardimr/workspace/portfolio/go_notification_service/internal/template", "confirm-email.html")
-
-	tmpl, err := template.ParseFiles(filepath)
-
-	if err != nil {
-		return "", err
-	}
-
-	buff := new(bytes.Buffer)
-	err = tmpl.Execute(buff, data)
-
-	if err != nil {
-		return "", err
-	}
-
-	return buff.String(), err
-}
@@ -0,0 +1,92 @@
+package emailtemplate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go_project_template/internal/emailtemplate/repository"
+	"go_project_template/internal/template"
+)
+
+// Cache serves the published templates to the notification consumer as a
+// template.Source. Lookups, including the ones that found nothing, are kept
+// for ttl so sending an email does not query the database; Listen drops them
+// as soon as another version is published.
+type Cache struct {
+	templateRepo repository.ITemplateRepository
+	ttl          time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	def     template.Definition
+	ok      bool
+	expires time.Time
+}
+
+func NewCache(templateRepo repository.ITemplateRepository, ttl time.Duration) *Cache {
+	return &Cache{
+		templateRepo: templateRepo,
+		ttl:          ttl,
+		entries:      map[string]cacheEntry{},
+	}
+}
+
+// Published implements template.Source. When the database cannot be reached
+// an expired entry is served rather than failing the email.
+func (c *Cache) Published(ctx context.Context, name string, loc string) (template.Definition, bool, error) {
+	key := cacheKey(name, loc)
+
+	c.mu.RLock()
+	entry, cached := c.entries[key]
+	c.mu.RUnlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.def, entry.ok, nil
+	}
+
+	published, err := c.templateRepo.GetPublishedTemplate(ctx, name, loc)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		entry = cacheEntry{}
+	case err != nil:
+		if cached {
+			log.Println("[template] serving stale", name, loc, err)
+			return entry.def, entry.ok, nil
+		}
+		return template.Definition{}, false, err
+	default:
+		entry = cacheEntry{def: published.Definition(), ok: true}
+	}
+	entry.expires = time.Now().Add(c.ttl)
+
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	return entry.def, entry.ok, nil
+}
+
+// Invalidate drops the cached lookup of name in loc.
+func (c *Cache) Invalidate(name string, loc string) {
+	c.mu.Lock()
+	delete(c.entries, cacheKey(name, loc))
+	c.mu.Unlock()
+}
+
+// Listen invalidates the entries announced by the template API until ctx is
+// done.
+func (c *Cache) Listen(ctx context.Context, invalidations repository.ITemplateRedisRepository) error {
+	return invalidations.SubscribeInvalidations(ctx, func(invalidation repository.Invalidation) {
+		c.Invalidate(invalidation.Name, invalidation.Locale)
+	})
+}
+
+func cacheKey(name string, loc string) string {
+	return name + ":" + loc
+}
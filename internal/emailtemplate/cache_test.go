@@ -0,0 +1,101 @@
+package emailtemplate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go_project_template/internal/emailtemplate"
+	"go_project_template/internal/emailtemplate/model"
+	"go_project_template/internal/emailtemplate/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublishedRepository only answers published lookups, counting them.
+type fakePublishedRepository struct {
+	repository.ITemplateRepository
+
+	published map[string]model.Template
+	err       error
+	lookups   int
+}
+
+func (r *fakePublishedRepository) GetPublishedTemplate(ctx context.Context, name string, locale string) (model.Template, error) {
+	r.lookups++
+	if r.err != nil {
+		return model.Template{}, r.err
+	}
+
+	published, ok := r.published[name+":"+locale]
+	if !ok {
+		return model.Template{}, sql.ErrNoRows
+	}
+	return published, nil
+}
+
+func newPublishedRepository() *fakePublishedRepository {
+	return &fakePublishedRepository{
+		published: map[string]model.Template{
+			"confirm-email:id": {Name: "confirm-email", Locale: "id", Version: 2, Status: model.StatusPublished, HTML: "<p>v2</p>"},
+		},
+	}
+}
+
+func TestCacheKeepsHitsAndMisses(t *testing.T) {
+	repo := newPublishedRepository()
+	cache := emailtemplate.NewCache(repo, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		def, ok, err := cache.Published(ctx, "confirm-email", "id")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 2, def.Version)
+
+		_, ok, err = cache.Published(ctx, "confirm-email", "en")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+
+	assert.Equal(t, 2, repo.lookups)
+}
+
+func TestCacheRefetchesAfterInvalidate(t *testing.T) {
+	repo := newPublishedRepository()
+	cache := emailtemplate.NewCache(repo, time.Minute)
+	ctx := context.Background()
+
+	_, _, err := cache.Published(ctx, "confirm-email", "id")
+	require.NoError(t, err)
+
+	repo.published["confirm-email:id"] = model.Template{Name: "confirm-email", Locale: "id", Version: 3, Status: model.StatusPublished}
+	cache.Invalidate("confirm-email", "id")
+
+	def, ok, err := cache.Published(ctx, "confirm-email", "id")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, def.Version)
+	assert.Equal(t, 2, repo.lookups)
+}
+
+func TestCacheServesStaleWhenDatabaseFails(t *testing.T) {
+	repo := newPublishedRepository()
+	cache := emailtemplate.NewCache(repo, 0)
+	ctx := context.Background()
+
+	_, _, err := cache.Published(ctx, "confirm-email", "id")
+	require.NoError(t, err)
+
+	repo.err = errors.New("connection refused")
+
+	def, ok, err := cache.Published(ctx, "confirm-email", "id")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, def.Version)
+
+	_, _, err = cache.Published(ctx, "confirm-email", "en")
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"go_project_template/internal/emailtemplate/model"
+	"go_project_template/internal/emailtemplate/usecase"
+	"go_project_template/internal/exception"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TemplateController struct {
+	templateUseCase usecase.ITemplateUseCase
+}
+
+func NewTemplateController(templateUseCase usecase.ITemplateUseCase) *TemplateController {
+	return &TemplateController{
+		templateUseCase: templateUseCase,
+	}
+}
+
+// Controller Implementation
+
+func (controller *TemplateController) CreateTemplate(ctx *gin.Context) {
+	var reqBody model.CreateTemplateReqBody
+
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	draft, err := controller.templateUseCase.CreateTemplate(ctx, reqBody)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, draft)
+}
+
+func (controller *TemplateController) ListVersions(ctx *gin.Context) {
+	var reqUri model.TemplateReqUri
+
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	versions, err := controller.templateUseCase.ListVersions(ctx, reqUri.Name, reqUri.Locale)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, versions)
+}
+
+func (controller *TemplateController) GetVersion(ctx *gin.Context) {
+	var reqUri model.TemplateVersionReqUri
+
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	version, err := controller.templateUseCase.GetTemplate(ctx, reqUri.Name, reqUri.Locale, reqUri.Version)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, version)
+}
+
+func (controller *TemplateController) UpdateDraft(ctx *gin.Context) {
+	var reqUri model.TemplateVersionReqUri
+	var reqBody model.UpdateTemplateReqBody
+
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	draft, err := controller.templateUseCase.UpdateDraft(ctx, reqUri.Name, reqUri.Locale, reqUri.Version, reqBody)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, draft)
+}
+
+func (controller *TemplateController) Publish(ctx *gin.Context) {
+	var reqUri model.TemplateVersionReqUri
+
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	published, err := controller.templateUseCase.Publish(ctx, reqUri.Name, reqUri.Locale, reqUri.Version)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, published)
+}
+
+func (controller *TemplateController) Rollback(ctx *gin.Context) {
+	var reqUri model.TemplateReqUri
+	var reqBody model.RollbackReqBody
+
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	// The body is optional, without it the previous version is published
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+			return
+		}
+	}
+
+	published, err := controller.templateUseCase.Rollback(ctx, reqUri.Name, reqUri.Locale, reqBody.Version)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, published)
+}
+
+// Preview renders a template as HTML, plain text or, with format=json, both
+// together with the subject. The data comes from an optional JSON body.
+func (controller *TemplateController) Preview(ctx *gin.Context) {
+	var reqUri model.TemplateReqUri
+	var reqQuery model.PreviewReqQuery
+	var reqBody model.PreviewReqBody
+
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	if err := ctx.ShouldBindQuery(&reqQuery); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	// The body is optional, without it the sample data is used
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+			return
+		}
+	}
+
+	preview, err := controller.templateUseCase.Preview(ctx, reqUri.Name, reqUri.Locale, reqQuery.Version, reqBody.Data)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	switch reqQuery.Format {
+	case "json":
+		ctx.JSON(http.StatusOK, preview)
+	case "text":
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(preview.Text))
+	default:
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(preview.HTML))
+	}
+}
+
+func (controller *TemplateController) SendTest(ctx *gin.Context) {
+	var reqUri model.TemplateReqUri
+	var reqBody model.SendTestReqBody
+
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, exception.NewHttpError(http.StatusBadRequest, "Bad Request", err))
+		return
+	}
+
+	sent, err := controller.templateUseCase.SendTest(ctx, reqUri.Name, reqUri.Locale, reqBody)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sent)
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"go_project_template/internal/emailtemplate/usecase"
+	"go_project_template/internal/exception"
+	"go_project_template/internal/template"
+	"net/http"
+)
+
+// errorResponse maps the errors of the template packages to their status,
+// anything else is left to exception.ErrorResponse.
+func errorResponse(err error) (int, exception.HttpError) {
+	var httpError exception.HttpError
+
+	switch {
+	case errors.Is(err, template.ErrTemplateNotFound):
+		httpError = exception.NewHttpError(http.StatusNotFound, "Not Found", err)
+	case errors.Is(err, template.ErrInvalidTemplate),
+		errors.Is(err, template.ErrMissingTranslation):
+		httpError = exception.NewHttpError(http.StatusBadRequest, "Invalid template", err)
+	case errors.Is(err, usecase.ErrNotDraft),
+		errors.Is(err, usecase.ErrNotArchived),
+		errors.Is(err, usecase.ErrNothingToRollBack):
+		httpError = exception.NewHttpError(http.StatusConflict, "Conflict", err)
+	case errors.Is(err, usecase.ErrRecipientDenied):
+		httpError = exception.NewHttpError(http.StatusForbidden, "Forbidden", err)
+	case errors.Is(err, usecase.ErrNoSender):
+		httpError = exception.NewHttpError(http.StatusServiceUnavailable, "Service Unavailable", err)
+	default:
+		return exception.ErrorResponse(err)
+	}
+
+	fmt.Println(err.Error())
+	return httpError.Status(), httpError
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"go_project_template/internal/template"
+	"time"
+)
+
+// A version starts as a draft and is the only one that can be edited.
+// Publishing it archives the version published before, rolling back
+// publishes an archived version again.
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+type Template struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Locale      string     `json:"locale"`
+	Version     int        `json:"version"`
+	Status      string     `json:"status"`
+	Subject     string     `json:"subject"`
+	HTML        string     `json:"html"`
+	Text        string     `json:"text"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+}
+
+func (t Template) Definition() template.Definition {
+	return template.Definition{
+		Name:    t.Name,
+		Locale:  t.Locale,
+		Version: t.Version,
+		Subject: t.Subject,
+		HTML:    t.HTML,
+		Text:    t.Text,
+	}
+}
+
+type CreateTemplateReqBody struct {
+	Name    string `json:"name" binding:"required"`
+	Locale  string `json:"locale" binding:"required,bcp47_language_tag"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type UpdateTemplateReqBody struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type TemplateReqUri struct {
+	Name   string `uri:"name" binding:"required"`
+	Locale string `uri:"locale" binding:"required,bcp47_language_tag"`
+}
+
+type TemplateVersionReqUri struct {
+	Name    string `uri:"name" binding:"required"`
+	Locale  string `uri:"locale" binding:"required,bcp47_language_tag"`
+	Version int    `uri:"version" binding:"required,min=1"`
+}
+
+// RollbackReqBody picks the version to publish again, the version published
+// before the current one when Version is 0.
+type RollbackReqBody struct {
+	Version int `json:"version"`
+}
+
+// PreviewReqQuery picks the part that is previewed and the version rendered,
+// the one the notification service sends when Version is 0.
+type PreviewReqQuery struct {
+	Format  string `form:"format" binding:"omitempty,oneof=html text json"`
+	Version int    `form:"version" binding:"min=0"`
+}
+
+// PreviewReqBody supplies the template data. The keys given replace the ones
+// of the stored sample data.
+type PreviewReqBody struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+type SendTestReqBody struct {
+	To      string                 `json:"to" binding:"required,email"`
+	Version int                    `json:"version" binding:"min=0"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// Preview is a rendered email. Text is generated from HTML when the
+// template has no text version, as it is when sent.
+type Preview struct {
+	Name    string `json:"name"`
+	Locale  string `json:"locale"`
+	Version int    `json:"version"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InvalidationChannel is the Redis channel announcing that the published
+// version of a template changed.
+const InvalidationChannel = "notification:templates:invalidate"
+
+type Invalidation struct {
+	Name   string `json:"name"`
+	Locale string `json:"locale"`
+}
+
+type ITemplateRedisRepository interface {
+	PublishInvalidation(ctx context.Context, invalidation Invalidation) error
+	SubscribeInvalidations(ctx context.Context, fn func(invalidation Invalidation)) error
+}
+
+type TemplateRedisRepository struct {
+	redisClient *redis.Client
+}
+
+func NewTemplateRedisRepository(redisClient *redis.Client) *TemplateRedisRepository {
+	return &TemplateRedisRepository{
+		redisClient: redisClient,
+	}
+}
+
+func (rc *TemplateRedisRepository) PublishInvalidation(ctx context.Context, invalidation Invalidation) error {
+	payload, err := json.Marshal(invalidation)
+
+	if err != nil {
+		return err
+	}
+
+	return rc.redisClient.Publish(ctx, InvalidationChannel, payload).Err()
+}
+
+// SubscribeInvalidations calls fn for every invalidation until ctx is done.
+// The client resubscribes after a lost connection by itself, invalidations
+// published in the meantime are missed.
+func (rc *TemplateRedisRepository) SubscribeInvalidations(ctx context.Context, fn func(invalidation Invalidation)) error {
+	pubsub := rc.redisClient.Subscribe(ctx, InvalidationChannel)
+	defer pubsub.Close()
+
+	// Report a failed subscription instead of silently missing invalidations
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var invalidation Invalidation
+			if err := json.Unmarshal([]byte(message.Payload), &invalidation); err != nil {
+				log.Println("[template] invalid invalidation:", err)
+				continue
+			}
+			fn(invalidation)
+		}
+	}
+}
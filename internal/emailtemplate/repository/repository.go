@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"go_project_template/configs/db"
+	"go_project_template/internal/emailtemplate/model"
+)
+
+type ITemplateRepository interface {
+	CreateTemplate(ctx context.Context, newTemplate model.Template) (model.Template, error)
+	GetTemplate(ctx context.Context, name string, locale string, version int) (model.Template, error)
+	GetPublishedTemplate(ctx context.Context, name string, locale string) (model.Template, error)
+	ListVersions(ctx context.Context, name string, locale string) ([]model.Template, error)
+	UpdateDraft(ctx context.Context, draft model.Template) (model.Template, error)
+	Publish(ctx context.Context, name string, locale string, version int, status string) (model.Template, error)
+}
+
+type TemplateRepository struct {
+	db db.DBInterface
+}
+
+func NewTemplateRepository(db db.DBInterface) *TemplateRepository {
+	return &TemplateRepository{
+		db: db,
+	}
+}
+
+const templateColumns = `
+		id,
+		name,
+		locale,
+		version,
+		status,
+		subject,
+		html,
+		text,
+		created_at,
+		updated_at,
+		published_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(row scanner) (model.Template, error) {
+	var emailTemplate model.Template
+	var publishedAt sql.NullTime
+
+	err := row.Scan(
+		&emailTemplate.ID,
+		&emailTemplate.Name,
+		&emailTemplate.Locale,
+		&emailTemplate.Version,
+		&emailTemplate.Status,
+		&emailTemplate.Subject,
+		&emailTemplate.HTML,
+		&emailTemplate.Text,
+		&emailTemplate.CreatedAt,
+		&emailTemplate.UpdatedAt,
+		&publishedAt,
+	)
+
+	if publishedAt.Valid {
+		emailTemplate.PublishedAt = &publishedAt.Time
+	}
+
+	return emailTemplate, err
+}
+
+// lockTemplate serializes the changes to the versions of a template in one
+// locale until tx ends. Row locks cannot cover the first version, which has
+// no row yet, so the lock is an advisory lock on the name and locale.
+func lockTemplate(ctx context.Context, tx *sql.Tx, name string, locale string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))`, name, locale)
+	return err
+}
+
+// CreateTemplate inserts a draft numbered after the latest version of the
+// template in its locale. Concurrent creates wait for each other, so they
+// never number two drafts the same.
+func (q *TemplateRepository) CreateTemplate(ctx context.Context, newTemplate model.Template) (model.Template, error) {
+	var draft model.Template
+
+	sqlStatement := `
+	INSERT INTO
+		notification.email_templates(name, locale, version, status, subject, html, text)
+	SELECT
+		$1, $2, COALESCE(MAX(version), 0) + 1, 'draft', $3, $4, $5
+	FROM notification.email_templates
+	WHERE name=$1 AND locale=$2
+	RETURNING` + templateColumns
+
+	err := db.Transaction(ctx, q.db, func(tx *sql.Tx) error {
+		if err := lockTemplate(ctx, tx, newTemplate.Name, newTemplate.Locale); err != nil {
+			return err
+		}
+
+		row := tx.QueryRowContext(ctx, sqlStatement,
+			newTemplate.Name,
+			newTemplate.Locale,
+			newTemplate.Subject,
+			newTemplate.HTML,
+			newTemplate.Text,
+		)
+
+		var err error
+		draft, err = scanTemplate(row)
+		return err
+	})
+
+	return draft, err
+}
+
+func (q *TemplateRepository) GetTemplate(ctx context.Context, name string, locale string, version int) (model.Template, error) {
+	queryStatement := `
+	SELECT` + templateColumns + `
+	FROM notification.email_templates
+	WHERE name=$1 AND locale=$2 AND version=$3
+	`
+
+	return scanTemplate(q.db.QueryRowContext(ctx, queryStatement, name, locale, version))
+}
+
+func (q *TemplateRepository) GetPublishedTemplate(ctx context.Context, name string, locale string) (model.Template, error) {
+	queryStatement := `
+	SELECT` + templateColumns + `
+	FROM notification.email_templates
+	WHERE name=$1 AND locale=$2 AND status='published'
+	`
+
+	return scanTemplate(q.db.QueryRowContext(ctx, queryStatement, name, locale))
+}
+
+// ListVersions returns the versions of the template in its locale, newest
+// first.
+func (q *TemplateRepository) ListVersions(ctx context.Context, name string, locale string) ([]model.Template, error) {
+	queryStatement := `
+	SELECT` + templateColumns + `
+	FROM notification.email_templates
+	WHERE name=$1 AND locale=$2
+	ORDER BY version DESC
+	`
+
+	rows, err := q.db.QueryContext(ctx, queryStatement, name, locale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []model.Template{}
+	for rows.Next() {
+		emailTemplate, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, emailTemplate)
+	}
+
+	return versions, rows.Err()
+}
+
+// UpdateDraft replaces the content of a draft, returning sql.ErrNoRows when
+// the version is not a draft (anymore).
+func (q *TemplateRepository) UpdateDraft(ctx context.Context, draft model.Template) (model.Template, error) {
+	sqlStatement := `
+	UPDATE notification.email_templates
+	SET
+		subject=$4,
+		html=$5,
+		text=$6,
+		updated_at=now()
+	WHERE name=$1 AND locale=$2 AND version=$3 AND status='draft'
+	RETURNING` + templateColumns
+
+	row := q.db.QueryRowContext(ctx, sqlStatement,
+		draft.Name,
+		draft.Locale,
+		draft.Version,
+		draft.Subject,
+		draft.HTML,
+		draft.Text,
+	)
+
+	return scanTemplate(row)
+}
+
+// Publish makes version the published one of the template in its locale and
+// archives the version published before, in one transaction so there is
+// always at most one. Concurrent publishes of the template wait for each
+// other, and only the first one finds version still in status: the others
+// change nothing and return sql.ErrNoRows.
+func (q *TemplateRepository) Publish(ctx context.Context, name string, locale string, version int, status string) (model.Template, error) {
+	var published model.Template
+
+	archiveStatement := `
+	UPDATE notification.email_templates
+	SET
+		status='archived',
+		updated_at=now()
+	WHERE name=$1 AND locale=$2 AND status='published'
+	`
+
+	publishStatement := `
+	UPDATE notification.email_templates
+	SET
+		status='published',
+		published_at=now(),
+		updated_at=now()
+	WHERE name=$1 AND locale=$2 AND version=$3 AND status=$4
+	RETURNING` + templateColumns
+
+	err := db.Transaction(ctx, q.db, func(tx *sql.Tx) error {
+		if err := lockTemplate(ctx, tx, name, locale); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, archiveStatement, name, locale); err != nil {
+			return err
+		}
+
+		var err error
+		published, err = scanTemplate(tx.QueryRowContext(ctx, publishStatement, name, locale, version, status))
+		return err
+	})
+
+	return published, err
+}
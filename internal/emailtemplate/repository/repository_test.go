@@ -0,0 +1,128 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go_project_template/internal/emailtemplate/model"
+	"go_project_template/internal/emailtemplate/repository"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var templateColumns = []string{
+	"id",
+	"name",
+	"locale",
+	"version",
+	"status",
+	"subject",
+	"html",
+	"text",
+	"created_at",
+	"updated_at",
+	"published_at",
+}
+
+func TestCreateTemplateNumbersVersions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`pg_advisory_xact_lock`)).
+		WithArgs("confirm-email", "id").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`COALESCE(MAX(version), 0) + 1, 'draft'`)).
+		WithArgs("confirm-email", "id", "Kode OTP", "<p>{{.OTPCode}}</p>", "").
+		WillReturnRows(sqlmock.NewRows(templateColumns).
+			AddRow(int64(1), "confirm-email", "id", 3, "draft", "Kode OTP", "<p>{{.OTPCode}}</p>", "", now, now, nil))
+	mock.ExpectCommit()
+
+	draft, err := repository.NewTemplateRepository(db).CreateTemplate(context.Background(), model.Template{
+		Name:    "confirm-email",
+		Locale:  "id",
+		Subject: "Kode OTP",
+		HTML:    "<p>{{.OTPCode}}</p>",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, draft.Version)
+	assert.Equal(t, model.StatusDraft, draft.Status)
+	assert.Nil(t, draft.PublishedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublishArchivesPreviousVersionInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`pg_advisory_xact_lock`)).
+		WithArgs("confirm-email", "id").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`status='archived'`)).
+		WithArgs("confirm-email", "id").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`status='published'`)).
+		WithArgs("confirm-email", "id", 3, model.StatusDraft).
+		WillReturnRows(sqlmock.NewRows(templateColumns).
+			AddRow(int64(1), "confirm-email", "id", 3, "published", "Kode OTP", "<p></p>", "", now, now, now))
+	mock.ExpectCommit()
+
+	published, err := repository.NewTemplateRepository(db).Publish(context.Background(), "confirm-email", "id", 3, model.StatusDraft)
+
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusPublished, published.Status)
+	require.NotNil(t, published.PublishedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublishRollsBackWhenVersionIsNoLongerDraft(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`pg_advisory_xact_lock`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`status='archived'`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`status='published'`)).
+		WillReturnRows(sqlmock.NewRows(templateColumns))
+	mock.ExpectRollback()
+
+	_, err = repository.NewTemplateRepository(db).Publish(context.Background(), "confirm-email", "id", 9, model.StatusDraft)
+
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListVersionsNewestFirst(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`ORDER BY version DESC`)).
+		WithArgs("confirm-email", "id").
+		WillReturnRows(sqlmock.NewRows(templateColumns).
+			AddRow(int64(2), "confirm-email", "id", 2, "draft", "", "<p></p>", "", now, now, nil).
+			AddRow(int64(1), "confirm-email", "id", 1, "published", "", "<p></p>", "", now, now, now))
+
+	versions, err := repository.NewTemplateRepository(db).ListVersions(context.Background(), "confirm-email", "id")
+
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Equal(t, model.StatusPublished, versions[1].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
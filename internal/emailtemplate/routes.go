@@ -0,0 +1,44 @@
+package emailtemplate
+
+import (
+	"go_project_template/internal/auth"
+	"go_project_template/internal/emailtemplate/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Router struct {
+	controller *controller.TemplateController
+	apiKey     string
+}
+
+// NewRouter serves the template API, every route requiring apiKey as a
+// bearer token. Without an apiKey the API is not served at all, as drafts and
+// previews are no more public than the changes.
+func NewRouter(controller *controller.TemplateController, apiKey string) *Router {
+	return &Router{
+		controller: controller,
+		apiKey:     apiKey,
+	}
+}
+
+func (router *Router) AddRoute(superRoute *gin.RouterGroup) {
+	router.templateRoutes(superRoute)
+}
+
+func (router *Router) templateRoutes(superRoute *gin.RouterGroup) {
+	if router.apiKey == "" {
+		return
+	}
+
+	templateRouter := superRoute.Group("/notification-service/templates", auth.RequireAPIKey(router.apiKey))
+	templateRouter.POST("", router.controller.CreateTemplate)
+	templateRouter.GET("/:name/:locale/versions", router.controller.ListVersions)
+	templateRouter.GET("/:name/:locale/versions/:version", router.controller.GetVersion)
+	templateRouter.PATCH("/:name/:locale/versions/:version", router.controller.UpdateDraft)
+	templateRouter.POST("/:name/:locale/versions/:version/publish", router.controller.Publish)
+	templateRouter.POST("/:name/:locale/rollback", router.controller.Rollback)
+	templateRouter.GET("/:name/:locale/preview", router.controller.Preview)
+	templateRouter.POST("/:name/:locale/preview", router.controller.Preview)
+	templateRouter.POST("/:name/:locale/send-test", router.controller.SendTest)
+}
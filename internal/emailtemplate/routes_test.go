@@ -0,0 +1,43 @@
+package emailtemplate_test
+
+import (
+	"go_project_template/internal/emailtemplate"
+	"go_project_template/internal/emailtemplate/controller"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateRoutesRequireAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		apiKey string
+		method string
+		path   string
+		want   int
+	}{
+		{"list versions", "secret", http.MethodGet, "/api/notification-service/templates/confirm-email/id/versions", http.StatusUnauthorized},
+		{"get version", "secret", http.MethodGet, "/api/notification-service/templates/confirm-email/id/versions/1", http.StatusUnauthorized},
+		{"preview", "secret", http.MethodGet, "/api/notification-service/templates/confirm-email/id/preview", http.StatusUnauthorized},
+		{"preview with data", "secret", http.MethodPost, "/api/notification-service/templates/confirm-email/id/preview", http.StatusUnauthorized},
+		{"publish", "secret", http.MethodPost, "/api/notification-service/templates/confirm-email/id/versions/1/publish", http.StatusUnauthorized},
+		{"without a key", "", http.MethodGet, "/api/notification-service/templates/confirm-email/id/versions", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := gin.New()
+			emailtemplate.NewRouter(controller.NewTemplateController(nil), tt.apiKey).AddRoute(server.Group("/api"))
+
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
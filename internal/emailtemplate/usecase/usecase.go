@@ -0,0 +1,332 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go_project_template/internal/emailtemplate/model"
+	"go_project_template/internal/emailtemplate/repository"
+	"go_project_template/internal/locale"
+	"go_project_template/internal/mail"
+	"go_project_template/internal/template"
+)
+
+var (
+	ErrNotDraft          = errors.New("template: only drafts can be changed or published")
+	ErrNotArchived       = errors.New("template: only archived versions can be rolled back to")
+	ErrNothingToRollBack = errors.New("template: no earlier published version to roll back to")
+	ErrNoSender          = errors.New("template: no email sender configured")
+	ErrRecipientDenied   = errors.New("template: recipient is not allowed to receive test sends")
+)
+
+// testSubjectPrefix marks test sends in the recipient's inbox.
+const testSubjectPrefix = "[Test] "
+
+type ITemplateUseCase interface {
+	CreateTemplate(ctx context.Context, reqBody model.CreateTemplateReqBody) (model.Template, error)
+	GetTemplate(ctx context.Context, name string, locale string, version int) (model.Template, error)
+	ListVersions(ctx context.Context, name string, locale string) ([]model.Template, error)
+	UpdateDraft(ctx context.Context, name string, locale string, version int, reqBody model.UpdateTemplateReqBody) (model.Template, error)
+	Publish(ctx context.Context, name string, locale string, version int) (model.Template, error)
+	Rollback(ctx context.Context, name string, locale string, version int) (model.Template, error)
+	Preview(ctx context.Context, name string, locale string, version int, data map[string]interface{}) (model.Preview, error)
+	SendTest(ctx context.Context, name string, locale string, reqBody model.SendTestReqBody) (model.Preview, error)
+}
+
+type TemplateUseCase struct {
+	templateRepo  repository.ITemplateRepository
+	invalidations repository.ITemplateRedisRepository
+	templates     *template.Registry
+	sender        mail.EmailSender
+	recipients    []string
+}
+
+// NewTemplateUseCase creates the template use case. Test sends only go to
+// the addresses in recipients, or to any address of a domain listed as
+// "@example.com". Without a sender they fail with ErrNoSender.
+func NewTemplateUseCase(templateRepo repository.ITemplateRepository, invalidations repository.ITemplateRedisRepository, templates *template.Registry, sender mail.EmailSender, recipients []string) *TemplateUseCase {
+	return &TemplateUseCase{
+		templateRepo:  templateRepo,
+		invalidations: invalidations,
+		templates:     templates,
+		sender:        sender,
+		recipients:    recipients,
+	}
+}
+
+// CreateTemplate stores a new draft version, checking that it parses with
+// the layouts, partials and functions the notification service renders it
+// with.
+func (uc *TemplateUseCase) CreateTemplate(ctx context.Context, reqBody model.CreateTemplateReqBody) (model.Template, error) {
+	loc, err := normalize(reqBody.Locale)
+	if err != nil {
+		return model.Template{}, err
+	}
+
+	newTemplate := model.Template{
+		Name:    reqBody.Name,
+		Locale:  loc,
+		Subject: reqBody.Subject,
+		HTML:    reqBody.HTML,
+		Text:    reqBody.Text,
+	}
+
+	if err := uc.templates.Validate(newTemplate.Definition()); err != nil {
+		return model.Template{}, err
+	}
+
+	return uc.templateRepo.CreateTemplate(ctx, newTemplate)
+}
+
+func (uc *TemplateUseCase) GetTemplate(ctx context.Context, name string, locale string, version int) (model.Template, error) {
+	loc, err := normalize(locale)
+	if err != nil {
+		return model.Template{}, err
+	}
+
+	return uc.templateRepo.GetTemplate(ctx, name, loc, version)
+}
+
+func (uc *TemplateUseCase) ListVersions(ctx context.Context, name string, locale string) ([]model.Template, error) {
+	loc, err := normalize(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.templateRepo.ListVersions(ctx, name, loc)
+}
+
+func (uc *TemplateUseCase) UpdateDraft(ctx context.Context, name string, locale string, version int, reqBody model.UpdateTemplateReqBody) (model.Template, error) {
+	draft, err := uc.GetTemplate(ctx, name, locale, version)
+	if err != nil {
+		return draft, err
+	}
+
+	if draft.Status != model.StatusDraft {
+		return draft, fmt.Errorf("%w: version %d is %s", ErrNotDraft, version, draft.Status)
+	}
+
+	draft.Subject = reqBody.Subject
+	draft.HTML = reqBody.HTML
+	draft.Text = reqBody.Text
+
+	if err := uc.templates.Validate(draft.Definition()); err != nil {
+		return draft, err
+	}
+
+	return uc.templateRepo.UpdateDraft(ctx, draft)
+}
+
+// Publish makes a draft the version the notification service sends.
+func (uc *TemplateUseCase) Publish(ctx context.Context, name string, locale string, version int) (model.Template, error) {
+	draft, err := uc.GetTemplate(ctx, name, locale, version)
+	if err != nil {
+		return draft, err
+	}
+
+	if draft.Status != model.StatusDraft {
+		return draft, fmt.Errorf("%w: version %d is %s", ErrNotDraft, version, draft.Status)
+	}
+
+	// Layouts or catalogs may have changed since the draft was saved
+	if err := uc.templates.Validate(draft.Definition()); err != nil {
+		return draft, err
+	}
+
+	return uc.publish(ctx, draft)
+}
+
+// Rollback publishes an archived version again, by default the one published
+// before the current version.
+func (uc *TemplateUseCase) Rollback(ctx context.Context, name string, locale string, version int) (model.Template, error) {
+	if version != 0 {
+		target, err := uc.GetTemplate(ctx, name, locale, version)
+		if err != nil {
+			return target, err
+		}
+
+		if target.Status != model.StatusArchived {
+			return target, fmt.Errorf("%w: version %d is %s", ErrNotArchived, version, target.Status)
+		}
+
+		return uc.publish(ctx, target)
+	}
+
+	versions, err := uc.ListVersions(ctx, name, locale)
+	if err != nil {
+		return model.Template{}, err
+	}
+
+	// Archived versions have all been published, the last one archived was
+	// published before the current one
+	var target *model.Template
+	for i, candidate := range versions {
+		if candidate.Status != model.StatusArchived || candidate.PublishedAt == nil {
+			continue
+		}
+		if target == nil || candidate.PublishedAt.After(*target.PublishedAt) {
+			target = &versions[i]
+		}
+	}
+
+	if target == nil {
+		return model.Template{}, ErrNothingToRollBack
+	}
+
+	return uc.publish(ctx, *target)
+}
+
+// Preview renders version of the template, or with version 0 the files or
+// published version the notification service would send in locale. data is
+// laid over the stored sample data of the template.
+func (uc *TemplateUseCase) Preview(ctx context.Context, name string, locale string, version int, data map[string]interface{}) (model.Preview, error) {
+	loc, err := normalize(locale)
+	if err != nil {
+		return model.Preview{}, err
+	}
+
+	sample, err := uc.templates.Sample(name)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	for key, value := range data {
+		sample[key] = value
+	}
+
+	var content template.Content
+	if version != 0 {
+		stored, err := uc.templateRepo.GetTemplate(ctx, name, loc, version)
+		if err != nil {
+			return model.Preview{}, err
+		}
+		content, err = uc.templates.RenderDefinition(stored.Definition(), sample)
+		if err != nil {
+			return model.Preview{}, err
+		}
+	} else {
+		// Reading the database directly, the caches of the workers may lag
+		// behind for a moment after a publish
+		content, err = uc.templates.RenderFrom(ctx, uc, name, loc, sample)
+		if err != nil {
+			return model.Preview{}, err
+		}
+	}
+
+	text := content.Text
+	if text == "" && content.HTML != "" {
+		if text, err = mail.HTMLToText(content.HTML); err != nil {
+			return model.Preview{}, err
+		}
+	}
+
+	return model.Preview{
+		Name:    name,
+		Locale:  content.Locale,
+		Version: content.Version,
+		Subject: content.Subject,
+		HTML:    content.HTML,
+		Text:    text,
+	}, nil
+}
+
+// SendTest delivers a preview to reqBody.To through the sender, with the
+// subject marked as a test.
+func (uc *TemplateUseCase) SendTest(ctx context.Context, name string, locale string, reqBody model.SendTestReqBody) (model.Preview, error) {
+	if uc.sender == nil {
+		return model.Preview{}, ErrNoSender
+	}
+	if !uc.allowedRecipient(reqBody.To) {
+		return model.Preview{}, fmt.Errorf("%w: %s", ErrRecipientDenied, reqBody.To)
+	}
+
+	preview, err := uc.Preview(ctx, name, locale, reqBody.Version, reqBody.Data)
+	if err != nil {
+		return preview, err
+	}
+	preview.Subject = testSubjectPrefix + preview.Subject
+
+	err = uc.sender.SendEmail(
+		ctx,
+		preview.Subject,
+		mail.Body{Text: preview.Text, HTML: preview.HTML},
+		[]string{reqBody.To},
+		nil,
+		nil,
+		nil,
+	)
+	if err != nil {
+		return preview, err
+	}
+
+	return preview, nil
+}
+
+func (uc *TemplateUseCase) allowedRecipient(address string) bool {
+	address = strings.ToLower(strings.TrimSpace(address))
+	domain := address[strings.LastIndex(address, "@")+1:]
+
+	for _, allowed := range uc.recipients {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" {
+			continue
+		}
+		if allowed == address || allowed == "@"+domain {
+			return true
+		}
+	}
+	return false
+}
+
+// Published implements template.Source with the published versions in the
+// database.
+func (uc *TemplateUseCase) Published(ctx context.Context, name string, loc string) (template.Definition, bool, error) {
+	published, err := uc.templateRepo.GetPublishedTemplate(ctx, name, loc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return template.Definition{}, false, nil
+	}
+	if err != nil {
+		return template.Definition{}, false, err
+	}
+
+	return published.Definition(), true, nil
+}
+
+// publish makes emailTemplate the published version, provided it still has
+// the status it was read with; a concurrent publish or rollback may have
+// changed it since.
+func (uc *TemplateUseCase) publish(ctx context.Context, emailTemplate model.Template) (model.Template, error) {
+	published, err := uc.templateRepo.Publish(ctx, emailTemplate.Name, emailTemplate.Locale, emailTemplate.Version, emailTemplate.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		conflict := ErrNotArchived
+		if emailTemplate.Status == model.StatusDraft {
+			conflict = ErrNotDraft
+		}
+		return published, fmt.Errorf("%w: version %d is no longer %s", conflict, emailTemplate.Version, emailTemplate.Status)
+	}
+	if err != nil {
+		return published, err
+	}
+
+	// The caches expire on their own when the invalidation is lost
+	err = uc.invalidations.PublishInvalidation(ctx, repository.Invalidation{
+		Name:   published.Name,
+		Locale: published.Locale,
+	})
+	if err != nil {
+		log.Println("[template] failed to invalidate", published.Name, published.Locale, err)
+	}
+
+	return published, nil
+}
+
+func normalize(tag string) (string, error) {
+	loc := locale.Normalize(tag)
+	if loc == "" {
+		return "", fmt.Errorf("%w: locale %q", template.ErrInvalidTemplate, tag)
+	}
+	return loc, nil
+}
@@ -0,0 +1,382 @@
+package usecase_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go_project_template/internal/emailtemplate/model"
+	"go_project_template/internal/emailtemplate/repository"
+	"go_project_template/internal/emailtemplate/usecase"
+	"go_project_template/internal/mail"
+	"go_project_template/internal/template"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTemplateRepository keeps the versions of every template in memory,
+// publishing the way the SQL statements do.
+type fakeTemplateRepository struct {
+	versions []model.Template
+
+	// beforePublish runs at the start of Publish, standing in for a
+	// concurrent request that got the lock first
+	beforePublish func()
+}
+
+func (r *fakeTemplateRepository) CreateTemplate(ctx context.Context, newTemplate model.Template) (model.Template, error) {
+	newTemplate.Version = 1
+	for _, existing := range r.versions {
+		if existing.Name == newTemplate.Name && existing.Locale == newTemplate.Locale && existing.Version >= newTemplate.Version {
+			newTemplate.Version = existing.Version + 1
+		}
+	}
+	newTemplate.Status = model.StatusDraft
+
+	r.versions = append(r.versions, newTemplate)
+	return newTemplate, nil
+}
+
+func (r *fakeTemplateRepository) find(name string, locale string, version int) (*model.Template, error) {
+	for i, existing := range r.versions {
+		if existing.Name == name && existing.Locale == locale && existing.Version == version {
+			return &r.versions[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeTemplateRepository) GetTemplate(ctx context.Context, name string, locale string, version int) (model.Template, error) {
+	found, err := r.find(name, locale, version)
+	if err != nil {
+		return model.Template{}, err
+	}
+	return *found, nil
+}
+
+func (r *fakeTemplateRepository) GetPublishedTemplate(ctx context.Context, name string, locale string) (model.Template, error) {
+	for _, existing := range r.versions {
+		if existing.Name == name && existing.Locale == locale && existing.Status == model.StatusPublished {
+			return existing, nil
+		}
+	}
+	return model.Template{}, sql.ErrNoRows
+}
+
+func (r *fakeTemplateRepository) ListVersions(ctx context.Context, name string, locale string) ([]model.Template, error) {
+	versions := []model.Template{}
+	for i := len(r.versions) - 1; i >= 0; i-- {
+		if r.versions[i].Name == name && r.versions[i].Locale == locale {
+			versions = append(versions, r.versions[i])
+		}
+	}
+	return versions, nil
+}
+
+func (r *fakeTemplateRepository) UpdateDraft(ctx context.Context, draft model.Template) (model.Template, error) {
+	found, err := r.find(draft.Name, draft.Locale, draft.Version)
+	if err != nil || found.Status != model.StatusDraft {
+		return model.Template{}, sql.ErrNoRows
+	}
+	*found = draft
+	return draft, nil
+}
+
+func (r *fakeTemplateRepository) Publish(ctx context.Context, name string, locale string, version int, status string) (model.Template, error) {
+	if hook := r.beforePublish; hook != nil {
+		r.beforePublish = nil
+		hook()
+	}
+
+	found, err := r.find(name, locale, version)
+	if err != nil {
+		return model.Template{}, err
+	}
+	if found.Status != status {
+		return model.Template{}, sql.ErrNoRows
+	}
+
+	for i, existing := range r.versions {
+		if existing.Name == name && existing.Locale == locale && existing.Status == model.StatusPublished {
+			r.versions[i].Status = model.StatusArchived
+		}
+	}
+
+	// Distinct publish times, as now() is per transaction
+	publishedAt := time.Now().Add(time.Duration(len(r.versions)) * time.Second)
+	found.Status = model.StatusPublished
+	found.PublishedAt = &publishedAt
+	return *found, nil
+}
+
+type fakeInvalidations struct {
+	published []repository.Invalidation
+	err       error
+}
+
+func (i *fakeInvalidations) PublishInvalidation(ctx context.Context, invalidation repository.Invalidation) error {
+	i.published = append(i.published, invalidation)
+	return i.err
+}
+
+func (i *fakeInvalidations) SubscribeInvalidations(ctx context.Context, fn func(invalidation repository.Invalidation)) error {
+	return nil
+}
+
+type sentEmail struct {
+	subject string
+	body    mail.Body
+	to      []string
+}
+
+type fakeSender struct {
+	sent []sentEmail
+}
+
+func (s *fakeSender) SendEmail(ctx context.Context, subject string, body mail.Body, to []string, cc []string, bcc []string, attachments []mail.Attachment) error {
+	s.sent = append(s.sent, sentEmail{subject: subject, body: body, to: to})
+	return nil
+}
+
+func newTemplateUseCase() (*usecase.TemplateUseCase, *fakeTemplateRepository, *fakeInvalidations) {
+	repo := &fakeTemplateRepository{}
+	invalidations := &fakeInvalidations{}
+
+	return usecase.NewTemplateUseCase(repo, invalidations, template.NewRegistry("", template.DefaultBrand), nil, nil), repo, invalidations
+}
+
+func createDraft(t *testing.T, uc *usecase.TemplateUseCase, text string) model.Template {
+	draft, err := uc.CreateTemplate(context.Background(), model.CreateTemplateReqBody{
+		Name:    "confirm-email",
+		Locale:  "id-id",
+		Subject: "Kode OTP {{brand.Product}}",
+		HTML:    `{{define "title"}}Konfirmasi{{end}}{{define "content"}}{{template "paragraph" .OTPCode}}{{end}}`,
+		Text:    text,
+	})
+	require.NoError(t, err)
+	return draft
+}
+
+func TestCreateTemplateAddsDraftVersions(t *testing.T) {
+	uc, _, _ := newTemplateUseCase()
+
+	first := createDraft(t, uc, "v1 {{.OTPCode}}")
+	second := createDraft(t, uc, "v2 {{.OTPCode}}")
+
+	assert.Equal(t, "id-ID", first.Locale)
+	assert.Equal(t, 1, first.Version)
+	assert.Equal(t, 2, second.Version)
+	assert.Equal(t, model.StatusDraft, second.Status)
+}
+
+func TestCreateTemplateRejectsInvalidTemplate(t *testing.T) {
+	uc, repo, _ := newTemplateUseCase()
+
+	_, err := uc.CreateTemplate(context.Background(), model.CreateTemplateReqBody{
+		Name:   "confirm-email",
+		Locale: "id",
+		HTML:   `{{template "paragraph" .OTPCode}`,
+	})
+
+	assert.ErrorIs(t, err, template.ErrInvalidTemplate)
+	assert.Empty(t, repo.versions)
+}
+
+func TestPublishArchivesPreviousAndInvalidates(t *testing.T) {
+	uc, repo, invalidations := newTemplateUseCase()
+	ctx := context.Background()
+
+	createDraft(t, uc, "v1")
+	createDraft(t, uc, "v2")
+
+	_, err := uc.Publish(ctx, "confirm-email", "id-ID", 1)
+	require.NoError(t, err)
+	published, err := uc.Publish(ctx, "confirm-email", "id-ID", 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, model.StatusPublished, published.Status)
+	assert.Equal(t, model.StatusArchived, repo.versions[0].Status)
+	assert.Equal(t, []repository.Invalidation{
+		{Name: "confirm-email", Locale: "id-ID"},
+		{Name: "confirm-email", Locale: "id-ID"},
+	}, invalidations.published)
+
+	_, err = uc.Publish(ctx, "confirm-email", "id-ID", 1)
+	assert.ErrorIs(t, err, usecase.ErrNotDraft)
+}
+
+func TestConcurrentPublishOfOneDraftConflicts(t *testing.T) {
+	uc, repo, invalidations := newTemplateUseCase()
+	ctx := context.Background()
+
+	createDraft(t, uc, "v1")
+	repo.beforePublish = func() {
+		_, err := uc.Publish(ctx, "confirm-email", "id-ID", 1)
+		require.NoError(t, err)
+	}
+
+	_, err := uc.Publish(ctx, "confirm-email", "id-ID", 1)
+
+	assert.ErrorIs(t, err, usecase.ErrNotDraft)
+	assert.Equal(t, model.StatusPublished, repo.versions[0].Status)
+	assert.Len(t, invalidations.published, 1)
+}
+
+func TestPublishSucceedsWhenInvalidationFails(t *testing.T) {
+	uc, _, invalidations := newTemplateUseCase()
+	invalidations.err = errors.New("redis: connection refused")
+
+	createDraft(t, uc, "v1")
+
+	published, err := uc.Publish(context.Background(), "confirm-email", "id-ID", 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusPublished, published.Status)
+}
+
+func TestUpdateDraftOnlyChangesDrafts(t *testing.T) {
+	uc, _, _ := newTemplateUseCase()
+	ctx := context.Background()
+
+	createDraft(t, uc, "v1")
+
+	updated, err := uc.UpdateDraft(ctx, "confirm-email", "id-ID", 1, model.UpdateTemplateReqBody{Subject: "Kode OTP", Text: "edited"})
+	require.NoError(t, err)
+	assert.Equal(t, "edited", updated.Text)
+
+	_, err = uc.Publish(ctx, "confirm-email", "id-ID", 1)
+	require.NoError(t, err)
+
+	_, err = uc.UpdateDraft(ctx, "confirm-email", "id-ID", 1, model.UpdateTemplateReqBody{Text: "too late"})
+	assert.ErrorIs(t, err, usecase.ErrNotDraft)
+
+	_, err = uc.UpdateDraft(ctx, "confirm-email", "id-ID", 7, model.UpdateTemplateReqBody{Text: "missing"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRollbackPublishesPreviousVersion(t *testing.T) {
+	uc, repo, invalidations := newTemplateUseCase()
+	ctx := context.Background()
+
+	for _, text := range []string{"v1", "v2", "v3"} {
+		draft := createDraft(t, uc, text)
+		_, err := uc.Publish(ctx, "confirm-email", "id-ID", draft.Version)
+		require.NoError(t, err)
+	}
+
+	published, err := uc.Rollback(ctx, "confirm-email", "id-ID", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, published.Version)
+	assert.Equal(t, model.StatusArchived, repo.versions[2].Status)
+	assert.Len(t, invalidations.published, 4)
+
+	published, err = uc.Rollback(ctx, "confirm-email", "id-ID", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published.Version)
+
+	_, err = uc.Rollback(ctx, "confirm-email", "id-ID", 1)
+	assert.ErrorIs(t, err, usecase.ErrNotArchived)
+}
+
+func TestRollbackWithoutEarlierVersion(t *testing.T) {
+	uc, _, _ := newTemplateUseCase()
+	ctx := context.Background()
+
+	_, err := uc.Rollback(ctx, "confirm-email", "id-ID", 0)
+	assert.ErrorIs(t, err, usecase.ErrNothingToRollBack)
+
+	createDraft(t, uc, "v1")
+	_, err = uc.Publish(ctx, "confirm-email", "id-ID", 1)
+	require.NoError(t, err)
+
+	_, err = uc.Rollback(ctx, "confirm-email", "id-ID", 0)
+	assert.ErrorIs(t, err, usecase.ErrNothingToRollBack)
+}
+
+func TestPreviewUsesSampleData(t *testing.T) {
+	uc, _, _ := newTemplateUseCase()
+
+	preview, err := uc.Preview(context.Background(), "confirm-email", "en", 0, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "OTP Request", preview.Subject)
+	assert.Equal(t, 0, preview.Version)
+	assert.Contains(t, preview.HTML, "Your OTP Code Is 123456")
+	assert.Contains(t, preview.Text, "Your OTP Code Is 123456")
+}
+
+func TestPreviewOverridesSampleData(t *testing.T) {
+	uc, _, _ := newTemplateUseCase()
+
+	preview, err := uc.Preview(context.Background(), "confirm-email", "id-ID", 0, map[string]interface{}{"OTPCode": "654321"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "id", preview.Locale)
+	assert.Contains(t, preview.HTML, "Kode OTP Anda adalah 654321")
+	assert.Contains(t, preview.HTML, "http://localhost:8080/api/verify-otp")
+}
+
+func TestPreviewRendersPublishedAndDraftVersions(t *testing.T) {
+	uc, _, _ := newTemplateUseCase()
+	ctx := context.Background()
+
+	createDraft(t, uc, "")
+	createDraft(t, uc, `{{define "title"}}Konfirmasi{{end}}{{define "content"}}v2 {{.OTPCode}}{{end}}`)
+	_, err := uc.Publish(ctx, "confirm-email", "id-ID", 1)
+	require.NoError(t, err)
+
+	preview, err := uc.Preview(ctx, "confirm-email", "id-ID", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, preview.Version)
+	assert.Equal(t, "Kode OTP Mata Duitan", preview.Subject)
+	assert.Contains(t, preview.Text, "123456")
+
+	preview, err = uc.Preview(ctx, "confirm-email", "id-ID", 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, preview.Version)
+	assert.Contains(t, preview.Text, "v2 123456")
+
+	_, err = uc.Preview(ctx, "missing-email", "en", 0, nil)
+	assert.ErrorIs(t, err, template.ErrTemplateNotFound)
+}
+
+func TestSendTestDeliversPreview(t *testing.T) {
+	sender := &fakeSender{}
+	uc := usecase.NewTemplateUseCase(&fakeTemplateRepository{}, &fakeInvalidations{}, template.NewRegistry("", template.DefaultBrand), sender, []string{"qa@example.com"})
+
+	sent, err := uc.SendTest(context.Background(), "confirm-email", "en", model.SendTestReqBody{To: "qa@example.com"})
+	require.NoError(t, err)
+
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "[Test] OTP Request", sender.sent[0].subject)
+	assert.Equal(t, sent.Subject, sender.sent[0].subject)
+	assert.Equal(t, []string{"qa@example.com"}, sender.sent[0].to)
+	assert.Contains(t, sender.sent[0].body.HTML, "123456")
+	assert.NotEmpty(t, sender.sent[0].body.Text)
+}
+
+func TestSendTestWithoutSender(t *testing.T) {
+	uc, _, _ := newTemplateUseCase()
+
+	_, err := uc.SendTest(context.Background(), "confirm-email", "en", model.SendTestReqBody{To: "qa@example.com"})
+	assert.ErrorIs(t, err, usecase.ErrNoSender)
+}
+
+func TestSendTestOnlyToAllowedRecipients(t *testing.T) {
+	sender := &fakeSender{}
+	uc := usecase.NewTemplateUseCase(&fakeTemplateRepository{}, &fakeInvalidations{}, template.NewRegistry("", template.DefaultBrand), sender, []string{"qa@example.com", "@staging.example.com"})
+	ctx := context.Background()
+
+	for _, to := range []string{"QA@example.com", "dev@staging.example.com"} {
+		_, err := uc.SendTest(ctx, "confirm-email", "en", model.SendTestReqBody{To: to})
+		assert.NoError(t, err, to)
+	}
+
+	for _, to := range []string{"victim@example.org", "dev@evil-staging.example.com", "qa@example.com.evil.org"} {
+		_, err := uc.SendTest(ctx, "confirm-email", "en", model.SendTestReqBody{To: to})
+		assert.ErrorIs(t, err, usecase.ErrRecipientDenied, to)
+	}
+
+	assert.Len(t, sender.sent, 2)
+}
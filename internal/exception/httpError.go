@@ -22,6 +22,9 @@ func NewHttpError(statusCode int, description string, metadata error) HttpError
 	}
 }
 
+// ParseError maps an error to its HTTP response. Requests never wait for the
+// broker: events are written to the outbox and published by the relay, so
+// publish failures do not reach this point.
 func ParseError(err error) HttpError {
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
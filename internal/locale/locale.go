@@ -0,0 +1,59 @@
+package locale
+
+import "golang.org/x/text/language"
+
+// Default is the locale every fallback chain ends with.
+const Default = "en"
+
+// Normalize returns the canonical form of a BCP 47 language tag, such as
+// "id-ID" for "id_id", or "" when tag is not a valid language tag.
+func Normalize(tag string) string {
+	parsed, err := language.Parse(tag)
+	if err != nil || parsed == language.Und {
+		return ""
+	}
+	return parsed.String()
+}
+
+// Fallbacks lists tag followed by its parents and Default, most specific
+// first: "id-ID" gives "id-ID", "id", "en". An invalid tag only gives
+// Default.
+func Fallbacks(tag string) []string {
+	var chain []string
+	seen := map[string]bool{}
+
+	add := func(locale string) {
+		if !seen[locale] {
+			seen[locale] = true
+			chain = append(chain, locale)
+		}
+	}
+
+	if parsed, err := language.Parse(tag); err == nil {
+		for ; parsed != language.Und; parsed = parsed.Parent() {
+			add(parsed.String())
+		}
+	}
+	add(Default)
+
+	return chain
+}
+
+// wildcard is the tag of the "*" Accept-Language wildcard.
+var wildcard = language.Make("mul")
+
+// FromAcceptLanguage returns the preferred language of an Accept-Language
+// header, or "" when it names none.
+func FromAcceptLanguage(header string) string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return ""
+	}
+
+	for _, tag := range tags {
+		if tag != language.Und && tag != wildcard {
+			return tag.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package locale
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "id-ID", Normalize("id_id"))
+	assert.Equal(t, "en", Normalize("EN"))
+	assert.Equal(t, "", Normalize(""))
+	assert.Equal(t, "", Normalize("../etc"))
+}
+
+func TestFallbacks(t *testing.T) {
+	assert.Equal(t, []string{"id-ID", "id", "en"}, Fallbacks("id-ID"))
+	assert.Equal(t, []string{"id", "en"}, Fallbacks("id"))
+	assert.Equal(t, []string{"en-US", "en"}, Fallbacks("en-US"))
+	assert.Equal(t, []string{"en"}, Fallbacks(""))
+	assert.Equal(t, []string{"en"}, Fallbacks("not a locale"))
+}
+
+func TestFromAcceptLanguage(t *testing.T) {
+	assert.Equal(t, "id-ID", FromAcceptLanguage("id-ID,id;q=0.9,en;q=0.8"))
+	assert.Equal(t, "id", FromAcceptLanguage("en;q=0.5, id"))
+	assert.Equal(t, "", FromAcceptLanguage("*"))
+	assert.Equal(t, "", FromAcceptLanguage(""))
+}
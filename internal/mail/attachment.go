@@ -0,0 +1,183 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gopkg.in/gomail.v2"
+)
+
+const (
+	defaultMaxAttachmentSize  = 10 << 20
+	defaultMaxAttachmentsSize = 18 << 20
+)
+
+var (
+	ErrInvalidAttachment  = errors.New("mail: invalid attachment")
+	ErrAttachmentTooLarge = errors.New("mail: attachment too large")
+)
+
+// ObjectStore reads attachments kept in object storage, see
+// cloudstorage.Minio.
+type ObjectStore interface {
+	GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error)
+}
+
+// Attachment is a file sent with an email. Its content comes from exactly one
+// of Data, Path (a local file) or Bucket and ObjectKey (object storage).
+// Filename defaults to the base name of Path or ObjectKey and ContentType is
+// derived from the Filename extension when empty.
+//
+// An attachment with a ContentID is embedded inline instead, so the HTML body
+// can show it with <img src="cid:ContentID">.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Path        string
+	Bucket      string
+	ObjectKey   string
+	ContentID   string
+}
+
+func (a Attachment) name() string {
+	switch {
+	case a.Filename != "":
+		return a.Filename
+	case a.Path != "":
+		return filepath.Base(a.Path)
+	default:
+		return path.Base(a.ObjectKey)
+	}
+}
+
+func (a Attachment) validate() error {
+	sources := 0
+	if a.Data != nil {
+		sources++
+	}
+	if a.Path != "" {
+		sources++
+	}
+	if a.ObjectKey != "" {
+		sources++
+	}
+
+	if sources != 1 {
+		return fmt.Errorf("%w: %q needs exactly one of Data, Path or ObjectKey", ErrInvalidAttachment, a.name())
+	}
+	if a.Data != nil && a.Filename == "" {
+		return fmt.Errorf("%w: attachment from Data needs a Filename", ErrInvalidAttachment)
+	}
+
+	return nil
+}
+
+// loadAttachments reads the content of every attachment, failing with
+// ErrAttachmentTooLarge before anything is sent when one of them exceeds
+// MaxAttachmentSize or all of them together exceed MaxAttachmentsSize.
+func (sender *SMTPSender) loadAttachments(ctx context.Context, attachments []Attachment) ([]Attachment, error) {
+	loaded := make([]Attachment, 0, len(attachments))
+	var total int64
+
+	for _, attachment := range attachments {
+		if err := attachment.validate(); err != nil {
+			return nil, err
+		}
+
+		data, err := sender.readAttachment(ctx, attachment)
+		if err != nil {
+			return nil, err
+		}
+
+		total += int64(len(data))
+		if total > sender.config.MaxAttachmentsSize {
+			return nil, fmt.Errorf("%w: attachments exceed %d bytes together", ErrAttachmentTooLarge, sender.config.MaxAttachmentsSize)
+		}
+
+		attachment.Filename = attachment.name()
+		attachment.Data = data
+		loaded = append(loaded, attachment)
+	}
+
+	return loaded, nil
+}
+
+func (sender *SMTPSender) readAttachment(ctx context.Context, attachment Attachment) ([]byte, error) {
+	limit := sender.config.MaxAttachmentSize
+	tooLarge := fmt.Errorf("%w: %s exceeds %d bytes", ErrAttachmentTooLarge, attachment.name(), limit)
+
+	switch {
+	case attachment.Data != nil:
+		if int64(len(attachment.Data)) > limit {
+			return nil, tooLarge
+		}
+		return attachment.Data, nil
+
+	case attachment.Path != "":
+		file, err := os.Open(attachment.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return readLimited(file, limit, tooLarge)
+
+	default:
+		if sender.storage == nil {
+			return nil, fmt.Errorf("%w: %s is in object storage but no ObjectStore is configured", ErrInvalidAttachment, attachment.name())
+		}
+
+		object, err := sender.storage.GetObject(ctx, attachment.Bucket, attachment.ObjectKey)
+		if err != nil {
+			return nil, err
+		}
+		defer object.Close()
+
+		return readLimited(object, limit, tooLarge)
+	}
+}
+
+// readLimited reads r, returning tooLarge as soon as more than limit bytes
+// were read rather than loading an oversized file completely.
+func readLimited(r io.Reader, limit int64, tooLarge error) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, tooLarge
+	}
+
+	return data, nil
+}
+
+// attach adds a loaded attachment to the message.
+func attach(mailer *gomail.Message, attachment Attachment) {
+	data := attachment.Data
+	settings := []gomail.FileSetting{
+		gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}),
+	}
+
+	header := map[string][]string{}
+	if attachment.ContentType != "" {
+		header["Content-Type"] = []string{attachment.ContentType + `; name="` + attachment.Filename + `"`}
+	}
+	settings = append(settings, gomail.SetHeader(header))
+
+	if attachment.ContentID == "" {
+		mailer.Attach(attachment.Filename, settings...)
+		return
+	}
+
+	header["Content-ID"] = []string{"<" + attachment.ContentID + ">"}
+	mailer.Embed(attachment.Filename, settings...)
+}
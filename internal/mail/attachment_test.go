@@ -0,0 +1,169 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeObjectStore map[string][]byte
+
+func (s fakeObjectStore) GetObject(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	data, ok := s[bucket+"/"+key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   string
+}
+
+// leafParts walks a MIME message and returns its non-multipart parts with
+// their bodies decoded.
+func leafParts(t *testing.T, header textproto.MIMEHeader, body io.Reader) []mimePart {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		switch header.Get("Content-Transfer-Encoding") {
+		case "base64":
+			data, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(data), "\r\n", ""))
+		case "quoted-printable":
+			data, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+		}
+		require.NoError(t, err)
+		return []mimePart{{header: header, body: string(data)}}
+	}
+
+	var parts []mimePart
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return parts
+		}
+		require.NoError(t, err)
+		parts = append(parts, leafParts(t, part.Header, part)...)
+	}
+}
+
+func TestSMTPSenderAttachments(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, nil)
+
+	path := filepath.Join(t.TempDir(), "terms.txt")
+	require.NoError(t, os.WriteFile(path, []byte("terms of service"), 0o600))
+
+	storage := fakeObjectStore{"invoices/2023/06/invoice.pdf": []byte("%PDF-1.4")}
+
+	sender, err := NewSMTPSender(testSMTPConfig(server, tlsConfig), storage)
+	require.NoError(t, err)
+
+	err = sender.SendEmail(
+		context.Background(),
+		"Your invoice",
+		Body{HTML: `<img src="cid:logo"> Thanks for your order`},
+		[]string{"user@example.com"},
+		nil,
+		nil,
+		[]Attachment{
+			{Filename: "report.csv", ContentType: "text/csv", Data: []byte("id,total\n1,10\n")},
+			{Path: path},
+			{Bucket: "invoices", ObjectKey: "2023/06/invoice.pdf"},
+			{Filename: "logo.png", Data: []byte("\x89PNG"), ContentID: "logo"},
+		},
+	)
+	require.NoError(t, err)
+
+	messages := server.received()
+	require.Len(t, messages, 1)
+
+	header, body := readMessage(t, messages[0].data)
+	parts := leafParts(t, header, strings.NewReader(body))
+	require.Len(t, parts, 6)
+
+	assert.Equal(t, "Thanks for your order", parts[0].body)
+	assert.Contains(t, parts[1].body, `<img src="cid:logo">`)
+
+	byName := map[string]mimePart{}
+	for _, part := range parts[2:] {
+		_, params, err := mime.ParseMediaType(part.header.Get("Content-Disposition"))
+		require.NoError(t, err)
+		byName[params["filename"]] = part
+	}
+
+	assert.Equal(t, "id,total\n1,10\n", byName["report.csv"].body)
+	assert.Contains(t, byName["report.csv"].header.Get("Content-Type"), "text/csv")
+	assert.Equal(t, "terms of service", byName["terms.txt"].body)
+	assert.Equal(t, "%PDF-1.4", byName["invoice.pdf"].body)
+
+	logo := byName["logo.png"]
+	assert.Equal(t, "\x89PNG", logo.body)
+	assert.Equal(t, "<logo>", logo.header.Get("Content-ID"))
+	assert.True(t, strings.HasPrefix(logo.header.Get("Content-Disposition"), "inline"))
+}
+
+func TestSMTPSenderRejectsOversizedAttachments(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, nil)
+
+	config := testSMTPConfig(server, tlsConfig)
+	config.MaxAttachmentSize = 10
+	config.MaxAttachmentsSize = 15
+	storage := fakeObjectStore{"bucket/big.bin": make([]byte, 11)}
+
+	sender, err := NewSMTPSender(config, storage)
+	require.NoError(t, err)
+
+	tests := map[string][]Attachment{
+		"data":   {{Filename: "big.bin", Data: make([]byte, 11)}},
+		"object": {{Bucket: "bucket", ObjectKey: "big.bin"}},
+		"total": {
+			{Filename: "a.bin", Data: make([]byte, 8)},
+			{Filename: "b.bin", Data: make([]byte, 8)},
+		},
+	}
+
+	for name, attachments := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := sender.SendEmail(context.Background(), "subject", Body{Text: "content"}, []string{"user@example.com"}, nil, nil, attachments)
+			assert.ErrorIs(t, err, ErrAttachmentTooLarge)
+		})
+	}
+
+	assert.Empty(t, server.received())
+}
+
+func TestSMTPSenderRejectsInvalidAttachments(t *testing.T) {
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: 25, FromAddress: "noreply@example.com"}, nil)
+	require.NoError(t, err)
+
+	tests := map[string]Attachment{
+		"no source":         {Filename: "empty.txt"},
+		"two sources":       {Filename: "a.txt", Data: []byte("a"), Path: "a.txt"},
+		"data without name": {Data: []byte("a")},
+		"no object store":   {Bucket: "bucket", ObjectKey: "a.txt"},
+	}
+
+	for name, attachment := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := sender.SendEmail(context.Background(), "subject", Body{Text: "content"}, []string{"user@example.com"}, nil, nil, []Attachment{attachment})
+			assert.ErrorIs(t, err, ErrInvalidAttachment)
+		})
+	}
+}
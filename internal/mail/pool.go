@@ -0,0 +1,159 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+const quitTimeout = time.Second
+
+// smtpConn is an SMTP session that has been greeted, upgraded to TLS and
+// authenticated, ready for the next MAIL FROM.
+type smtpConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// close ends the session with QUIT when the server is still listening.
+func (c *smtpConn) close() {
+	c.conn.SetDeadline(time.Now().Add(quitTimeout))
+	c.client.Quit()
+	c.conn.Close()
+}
+
+// connPool hands out at most size connections at a time. Idle connections
+// are kept for reuse and closed once they have been idle for idleTimeout,
+// before the server drops them.
+type connPool struct {
+	open        func(ctx context.Context) (*smtpConn, error)
+	idle        chan *smtpConn
+	slots       chan struct{}
+	idleTimeout time.Duration
+	done        chan struct{}
+}
+
+func newConnPool(size int, idleTimeout time.Duration, open func(ctx context.Context) (*smtpConn, error)) *connPool {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &connPool{
+		open:        open,
+		idle:        make(chan *smtpConn, size),
+		slots:       make(chan struct{}, size),
+		idleTimeout: idleTimeout,
+		done:        make(chan struct{}),
+	}
+	go p.reap()
+
+	return p
+}
+
+// get borrows a connection, blocking while every connection is in use. An
+// idle connection is checked with RSET first, so one the server has closed
+// in the meantime is replaced before any mail is sent on it.
+func (p *connPool) get(ctx context.Context) (*smtpConn, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		select {
+		case c := <-p.idle:
+			if p.stale(c) {
+				c.close()
+				continue
+			}
+
+			if deadline, ok := ctx.Deadline(); ok {
+				c.conn.SetDeadline(deadline)
+			}
+			if err := c.client.Reset(); err != nil {
+				c.conn.Close()
+				continue
+			}
+			return c, nil
+		default:
+		}
+
+		c, err := p.open(ctx)
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+// put returns a borrowed connection. Connections whose state is unknown,
+// such as after a network error or a timeout, must be returned with healthy
+// set to false.
+func (p *connPool) put(c *smtpConn, healthy bool) {
+	if healthy {
+		c.conn.SetDeadline(time.Time{})
+		c.lastUsed = time.Now()
+		p.keep(c)
+	} else {
+		c.conn.Close()
+	}
+
+	<-p.slots
+}
+
+// keep adds c to the idle connections. While the reaper holds a connection
+// the pool can briefly have one more than it keeps, the extra one is closed.
+func (p *connPool) keep(c *smtpConn) {
+	select {
+	case p.idle <- c:
+	default:
+		c.close()
+	}
+}
+
+func (p *connPool) stale(c *smtpConn) bool {
+	return time.Since(c.lastUsed) >= p.idleTimeout
+}
+
+// reap closes connections that have been idle for idleTimeout.
+func (p *connPool) reap() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+
+		for i := len(p.idle); i > 0; i-- {
+			select {
+			case c := <-p.idle:
+				if p.stale(c) {
+					c.close()
+					continue
+				}
+				p.keep(c)
+			default:
+			}
+		}
+	}
+}
+
+func (p *connPool) close() {
+	close(p.done)
+
+	for {
+		select {
+		case c := <-p.idle:
+			c.close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMTPSenderReusesConnections(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, nil)
+
+	sender, err := NewSMTPSender(testSMTPConfig(server, tlsConfig), nil)
+	require.NoError(t, err)
+	defer sender.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTestEmail(sender))
+	}
+
+	messages := server.received()
+	require.Len(t, messages, 3)
+	for _, msg := range messages {
+		assert.True(t, msg.tls)
+		assert.Equal(t, "user", msg.username)
+	}
+
+	sessions, _ := server.sessionCount()
+	assert.Equal(t, 1, sessions)
+}
+
+func TestSMTPSenderReconnectsWhenServerHangsUp(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, func(s *fakeSMTPServer) {
+		s.hangUpAfter = 1
+	})
+
+	sender, err := NewSMTPSender(testSMTPConfig(server, tlsConfig), nil)
+	require.NoError(t, err)
+	defer sender.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sendTestEmail(sender))
+	}
+
+	assert.Len(t, server.received(), 3)
+	sessions, _ := server.sessionCount()
+	assert.Equal(t, 3, sessions)
+}
+
+func TestSMTPSenderKeepsConnectionAfterRejectedRecipient(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, func(s *fakeSMTPServer) {
+		s.rejected = map[string]bool{"blocked@example.com": true}
+	})
+
+	sender, err := NewSMTPSender(testSMTPConfig(server, tlsConfig), nil)
+	require.NoError(t, err)
+	defer sender.Close()
+
+	err = sender.SendEmail(context.Background(), "subject", Body{Text: "content"}, []string{"blocked@example.com"}, nil, nil, nil)
+	assert.Error(t, err)
+
+	require.NoError(t, sendTestEmail(sender))
+
+	messages := server.received()
+	require.Len(t, messages, 1)
+	assert.Equal(t, []string{"user@example.com", "support@example.com", "audit@example.com"}, messages[0].recipients)
+
+	sessions, _ := server.sessionCount()
+	assert.Equal(t, 1, sessions)
+}
+
+func TestSMTPSenderClosesIdleConnections(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, nil)
+
+	config := testSMTPConfig(server, tlsConfig)
+	config.IdleTimeout = 50 * time.Millisecond
+	sender, err := NewSMTPSender(config, nil)
+	require.NoError(t, err)
+	defer sender.Close()
+
+	require.NoError(t, sendTestEmail(sender))
+
+	assert.Eventually(t, func() bool {
+		_, active := server.sessionCount()
+		return active == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The next send opens a new connection
+	require.NoError(t, sendTestEmail(sender))
+	sessions, _ := server.sessionCount()
+	assert.Equal(t, 2, sessions)
+}
+
+func TestSMTPSenderSendBatch(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, func(s *fakeSMTPServer) {
+		s.rejected = map[string]bool{"blocked@example.com": true}
+	})
+
+	config := testSMTPConfig(server, tlsConfig)
+	config.PoolSize = 3
+	sender, err := NewSMTPSender(config, nil)
+	require.NoError(t, err)
+	defer sender.Close()
+
+	var emails []Email
+	for i := 0; i < 20; i++ {
+		emails = append(emails, Email{
+			Subject: fmt.Sprintf("Newsletter %d", i),
+			Body:    Body{Text: "Hello"},
+			To:      []string{fmt.Sprintf("user%d@example.com", i)},
+		})
+	}
+	emails[7].To = []string{"blocked@example.com"}
+
+	err = sender.SendBatch(context.Background(), emails)
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Failed, 1)
+	assert.Contains(t, batchErr.Failed, 7)
+
+	assert.Len(t, server.received(), 19)
+	sessions, _ := server.sessionCount()
+	assert.LessOrEqual(t, sessions, 3)
+}
+
+// BenchmarkSMTPSender compares opening a connection per email with the
+// pooled sender against a local STARTTLS server with PLAIN authentication.
+func BenchmarkSMTPSender(b *testing.B) {
+	server, tlsConfig := startFakeSMTPServer(b, nil)
+
+	email := Email{
+		Subject: "OTP Request",
+		Body:    Body{Text: "Your OTP code is 123456", HTML: "<b>123456</b>"},
+		To:      []string{"user@example.com"},
+	}
+
+	newSender := func(b *testing.B) *SMTPSender {
+		sender, err := NewSMTPSender(testSMTPConfig(server, tlsConfig), nil)
+		require.NoError(b, err)
+		b.Cleanup(sender.Close)
+		return sender
+	}
+
+	b.Run("dial-per-email", func(b *testing.B) {
+		sender := newSender(b)
+		ctx := context.Background()
+		msg, recipients, err := sender.compose(ctx, email)
+		require.NoError(b, err)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c, err := sender.open(ctx)
+			require.NoError(b, err)
+			require.NoError(b, sender.deliver(ctx, c, recipients, msg))
+			c.close()
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		sender := newSender(b)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			require.NoError(b, sender.send(context.Background(), email))
+		}
+	})
+
+	b.Run("batch", func(b *testing.B) {
+		sender := newSender(b)
+		emails := make([]Email, b.N)
+		for i := range emails {
+			emails[i] = email
+		}
+
+		b.ResetTimer()
+		require.NoError(b, sender.SendBatch(context.Background(), emails))
+	})
+}
@@ -1,85 +1,53 @@
 package mail
 
 import (
-	"html/template"
-	"log"
-	"net/http"
-	"path"
-
-	"github.com/gin-gonic/gin"
-	"gopkg.in/gomail.v2"
+	"context"
+	"fmt"
 )
 
-type EmailSender interface {
-	SendEmail(
-		subject string,
-		content string,
-		to []string,
-		cc []string,
-		bcc []string,
-		attachFiles []string,
-	) error
+// Body is the content of an email. A body with both parts is sent as
+// multipart/alternative; without Text, it is generated from HTML.
+type Body struct {
+	Text string
+	HTML string
 }
 
-type GmailSender struct {
-	name              string
-	fromEmailAddress  string
-	fromEmailPassword string
-	dialer            *gomail.Dialer
+// Email is one message of a batch, see SMTPSender.SendBatch.
+type Email struct {
+	Subject     string
+	Body        Body
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Attachments []Attachment
 }
 
-func NewGmailSender(dialer *gomail.Dialer, name string, fromEmailAddress string, fromEmailPassword string) *GmailSender {
-	return &GmailSender{
-		name:              name,
-		fromEmailAddress:  fromEmailAddress,
-		fromEmailPassword: fromEmailAddress,
-		dialer:            dialer,
-	}
+// BatchError lists the emails of a batch that were not sent, by their index
+// in the batch.
+type BatchError struct {
+	Failed map[int]error
 }
 
-func (sender *GmailSender) SendEmail(
-	subject string,
-	content string,
-	to []string,
-	cc []string,
-	bcc []string,
-	attachFiles []string,
-) error {
-	mailer := gomail.NewMessage()
-	mailer.SetHeader("From", sender.fromEmailAddress)
-	mailer.SetHeader("To", to...)
-	mailer.SetHeader("Subject", subject)
-	mailer.SetBody("text/html", content)
-
-	err := sender.dialer.DialAndSend(mailer)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	log.Println("Mail sent!")
-
-	return err
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("mail: %d emails of the batch failed", len(e.Failed))
 }
 
-func RenderTemplate(ctx *gin.Context) {
-	filepath := path.Join("/home/ardimr/workspace/portfolio/go_notification_service/internal/template", "confirm-email.html")
-
-	tmpl, err := template.ParseFiles(filepath)
-
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
-		return
-	}
-
-	data := map[string]interface{}{
-		"Product": "Mata Duitan",
-		"OTPCode": "123456",
-		"URL":     "http://localhost:8080/api/verify-otp?otp_code=123456",
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
 	}
+	return errs
+}
 
-	err = tmpl.Execute(ctx.Writer, data)
-
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
-		return
-	}
+type EmailSender interface {
+	SendEmail(
+		ctx context.Context,
+		subject string,
+		body Body,
+		to []string,
+		cc []string,
+		bcc []string,
+		attachments []Attachment,
+	) error
 }
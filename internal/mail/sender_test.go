@@ -1,41 +1,49 @@
 package mail
 
 import (
+	"context"
+	"os"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/require"
-	"gopkg.in/gomail.v2"
 )
 
-const CONFIG_SMTP_HOST = "smtp.gmail.com"
-const CONFIG_SMTP_PORT = 587
-const CONFIG_SENDER_NAME = "Rizky Ardi Maulana <rizkyardimaulana@gmail.com>"
-const CONFIG_AUTH_EMAIL = ""
-const CONFIG_AUTH_PASSWORD = ""
+// TestSendEmailWithSMTP sends a real email. It runs only when
+// CONFIG_SMTP_HOST and SMTP_TEST_RECIPIENT are set, e.g.
+//
+//	CONFIG_SMTP_HOST=smtp.gmail.com CONFIG_SMTP_PORT=587 \
+//	CONFIG_AUTH_EMAIL=... CONFIG_AUTH_PASSWORD=... \
+//	SMTP_TEST_RECIPIENT=me@example.com go test -run=WithSMTP ./internal/mail
+func TestSendEmailWithSMTP(t *testing.T) {
+	host := os.Getenv("CONFIG_SMTP_HOST")
+	recipient := os.Getenv("SMTP_TEST_RECIPIENT")
+	if host == "" || recipient == "" {
+		t.Skip("CONFIG_SMTP_HOST or SMTP_TEST_RECIPIENT is not set")
+	}
 
-func TestSendEmailWithGmail(t *testing.T) {
-	// Dial
-	dialer := gomail.NewDialer(
-		CONFIG_SMTP_HOST,
-		CONFIG_SMTP_PORT,
-		CONFIG_AUTH_EMAIL,
-		CONFIG_AUTH_PASSWORD,
-	)
-	// Create a new sender
-	senderGmail := NewGmailSender(
-		dialer,
-		CONFIG_SENDER_NAME,
-		CONFIG_AUTH_EMAIL,
-		CONFIG_AUTH_PASSWORD,
-	)
+	port, err := strconv.Atoi(os.Getenv("CONFIG_SMTP_PORT"))
+	require.NoError(t, err)
 
-	err := senderGmail.SendEmail(
+	sender, err := NewSMTPSender(SMTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("CONFIG_AUTH_EMAIL"),
+		Password: os.Getenv("CONFIG_AUTH_PASSWORD"),
+		Auth:     os.Getenv("CONFIG_SMTP_AUTH"),
+		TLS:      os.Getenv("CONFIG_SMTP_TLS"),
+		FromName: os.Getenv("CONFIG_SENDER_NAME"),
+	}, nil)
+	require.NoError(t, err)
+
+	err = sender.SendEmail(
+		context.Background(),
 		"test mail",
-		"Hello, <b>This is a test email</b>",
-		[]string{"fixenog400@estudys.com"},
-		[]string{},
+		Body{HTML: "Hello, <b>This is a test email</b>"},
+		[]string{recipient},
 		[]string{},
 		[]string{},
+		nil,
 	)
 
 	require.NoError(t, err)
@@ -0,0 +1,489 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// TLS modes. STARTTLS upgrades a plain connection (usually port 587),
+// implicit TLS encrypts from the first byte (usually port 465).
+const (
+	TLSStartTLS = "starttls"
+	TLSImplicit = "implicit"
+	TLSNone     = "none"
+)
+
+// Authentication mechanisms
+const (
+	AuthPlain   = "PLAIN"
+	AuthLogin   = "LOGIN"
+	AuthCRAMMD5 = "CRAM-MD5"
+)
+
+const (
+	defaultSendTimeout = 30 * time.Second
+	defaultPoolSize    = 4
+	defaultIdleTimeout = 30 * time.Second
+)
+
+var (
+	ErrEmptyBody           = errors.New("mail: empty body")
+	ErrInvalidConfig       = errors.New("mail: invalid smtp config")
+	ErrStartTLSUnsupported = errors.New("mail: server does not support STARTTLS")
+)
+
+// SMTPConfig describes the SMTP server and the sender identity.
+//
+// TLS defaults to STARTTLS, which fails when the server does not offer it
+// rather than sending credentials in clear text. Auth is only used when a
+// Username is set and defaults to PLAIN; PLAIN and LOGIN refuse to run over
+// an unencrypted connection to anything but localhost.
+//
+// FromAddress defaults to Username and FromName is shown as the display
+// name. HELO is the name announced to the server, "localhost" when empty.
+// Timeout bounds a whole send, including waiting for a free connection.
+//
+// Up to PoolSize connections (default 4) are kept open and reused; one idle
+// for IdleTimeout (default 30s) is closed, since servers drop idle clients
+// after a while anyway.
+//
+// MaxAttachmentSize limits each attachment and MaxAttachmentsSize all of
+// them together, 10 MiB and 18 MiB by default. Attachments grow by a third
+// when base64 encoded, so the defaults stay below the common 25 MB limit.
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	Auth        string
+	TLS         string
+	TLSConfig   *tls.Config
+	HELO        string
+	FromName    string
+	FromAddress string
+	ReplyTo     string
+	Timeout     time.Duration
+	PoolSize    int
+	IdleTimeout time.Duration
+
+	MaxAttachmentSize  int64
+	MaxAttachmentsSize int64
+}
+
+func (c SMTPConfig) validate() error {
+	if c.Host == "" || c.Port <= 0 {
+		return fmt.Errorf("%w: host and port are required", ErrInvalidConfig)
+	}
+	if c.FromAddress == "" {
+		return fmt.Errorf("%w: from address is required", ErrInvalidConfig)
+	}
+
+	switch c.TLS {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return fmt.Errorf("%w: unknown tls mode %q", ErrInvalidConfig, c.TLS)
+	}
+
+	switch c.Auth {
+	case AuthPlain, AuthLogin, AuthCRAMMD5:
+	default:
+		return fmt.Errorf("%w: unknown auth mechanism %q", ErrInvalidConfig, c.Auth)
+	}
+
+	return nil
+}
+
+// SMTPSender sends email through any SMTP server. Authenticated connections
+// are pooled and reused for later sends, so bulk sends only pay for the
+// TCP, TLS and AUTH handshakes once per connection.
+type SMTPSender struct {
+	config  SMTPConfig
+	auth    smtp.Auth
+	storage ObjectStore
+	pool    *connPool
+}
+
+// NewSMTPSender creates a sender. storage is only needed for attachments
+// kept in object storage and may be nil.
+func NewSMTPSender(config SMTPConfig, storage ObjectStore) (*SMTPSender, error) {
+	if config.TLS == "" {
+		config.TLS = TLSStartTLS
+	}
+	if config.Auth == "" {
+		config.Auth = AuthPlain
+	}
+	if config.FromAddress == "" {
+		config.FromAddress = config.Username
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultSendTimeout
+	}
+	if config.PoolSize <= 0 {
+		config.PoolSize = defaultPoolSize
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultIdleTimeout
+	}
+	if config.MaxAttachmentSize <= 0 {
+		config.MaxAttachmentSize = defaultMaxAttachmentSize
+	}
+	if config.MaxAttachmentsSize <= 0 {
+		config.MaxAttachmentsSize = defaultMaxAttachmentsSize
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	sender := &SMTPSender{config: config, storage: storage}
+	sender.pool = newConnPool(config.PoolSize, config.IdleTimeout, sender.open)
+
+	if config.Username != "" {
+		switch config.Auth {
+		case AuthPlain:
+			sender.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+		case AuthLogin:
+			sender.auth = &loginAuth{username: config.Username, password: config.Password, host: config.Host}
+		case AuthCRAMMD5:
+			sender.auth = smtp.CRAMMD5Auth(config.Username, config.Password)
+		}
+	}
+
+	return sender, nil
+}
+
+func (sender *SMTPSender) SendEmail(
+	ctx context.Context,
+	subject string,
+	body Body,
+	to []string,
+	cc []string,
+	bcc []string,
+	attachments []Attachment,
+) error {
+	return sender.send(ctx, Email{
+		Subject:     subject,
+		Body:        body,
+		To:          to,
+		Cc:          cc,
+		Bcc:         bcc,
+		Attachments: attachments,
+	})
+}
+
+// SendBatch sends emails over the pooled connections, up to PoolSize at a
+// time, and returns a *BatchError listing the ones that failed. Each email
+// gets its own Timeout.
+func (sender *SMTPSender) SendBatch(ctx context.Context, emails []Email) error {
+	workers := sender.config.PoolSize
+	if workers > len(emails) {
+		workers = len(emails)
+	}
+
+	var mu sync.Mutex
+	failed := map[int]error{}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := sender.send(ctx, emails[i]); err != nil {
+					mu.Lock()
+					failed[i] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range emails {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// Close closes the idle connections. Sending after Close is not supported.
+func (sender *SMTPSender) Close() {
+	sender.pool.close()
+}
+
+// compose builds the message and its envelope recipients.
+func (sender *SMTPSender) compose(ctx context.Context, email Email) (*gomail.Message, []string, error) {
+	body := email.Body
+	if body.Text == "" && body.HTML == "" {
+		return nil, nil, ErrEmptyBody
+	}
+
+	// Clients that cannot or will not show HTML fall back to the text part
+	text := body.Text
+	if text == "" {
+		var err error
+		if text, err = HTMLToText(body.HTML); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Load attachments first, an oversized one fails before connecting
+	loaded, err := sender.loadAttachments(ctx, email.Attachments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mailer := gomail.NewMessage()
+	mailer.SetAddressHeader("From", sender.config.FromAddress, sender.config.FromName)
+	if sender.config.ReplyTo != "" {
+		mailer.SetHeader("Reply-To", sender.config.ReplyTo)
+	}
+	mailer.SetHeader("To", email.To...)
+	if len(email.Cc) > 0 {
+		mailer.SetHeader("Cc", email.Cc...)
+	}
+	// Bcc only goes into the envelope, gomail does not write the header
+	if len(email.Bcc) > 0 {
+		mailer.SetHeader("Bcc", email.Bcc...)
+	}
+	mailer.SetHeader("Subject", email.Subject)
+	mailer.SetBody("text/plain", text)
+	if body.HTML != "" {
+		mailer.AddAlternative("text/html", body.HTML)
+	}
+	for _, attachment := range loaded {
+		attach(mailer, attachment)
+	}
+
+	var recipients []string
+	for _, list := range [][]string{email.To, email.Cc, email.Bcc} {
+		for _, recipient := range list {
+			address, err := netmail.ParseAddress(recipient)
+			if err != nil {
+				return nil, nil, fmt.Errorf("mail: invalid recipient %q: %w", recipient, err)
+			}
+			recipients = append(recipients, address.Address)
+		}
+	}
+
+	return mailer, recipients, nil
+}
+
+// send delivers one email over a pooled connection. When ctx ends or the
+// Timeout passes, the connection is closed and ctx.Err() is returned.
+func (sender *SMTPSender) send(ctx context.Context, email Email) error {
+	msg, recipients, err := sender.compose(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sender.config.Timeout)
+	defer cancel()
+
+	c, err := sender.pool.get(ctx)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = sender.deliver(ctx, c, recipients, msg)
+
+	// A rejected command (5xx, 4xx) leaves the session usable, anything else
+	// such as a network error leaves it in an unknown state
+	var reply *textproto.Error
+	sender.pool.put(c, err == nil || errors.As(err, &reply))
+
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+// contextError returns ctx.Err() for an error caused by ctx ending. The
+// connection deadline can fire just before the context notices its own.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+	}
+
+	return err
+}
+
+func (sender *SMTPSender) deliver(ctx context.Context, c *smtpConn, recipients []string, msg *gomail.Message) error {
+	// Reads and writes on the connection fail once ctx is done
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+
+	// Wait for the watcher to stop, the connection must not be closed once
+	// it is back in the pool
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			c.conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := c.client.Mail(sender.config.FromAddress); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := c.client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// open starts a new session: connect, greet, upgrade to TLS and
+// authenticate.
+func (sender *SMTPSender) open(ctx context.Context) (*smtpConn, error) {
+	conn, err := sender.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, sender.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := sender.handshake(client); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &smtpConn{conn: conn, client: client}, nil
+}
+
+func (sender *SMTPSender) dial(ctx context.Context) (net.Conn, error) {
+	address := net.JoinHostPort(sender.config.Host, strconv.Itoa(sender.config.Port))
+
+	if sender.config.TLS == TLSImplicit {
+		dialer := &tls.Dialer{Config: sender.tlsConfig()}
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+func (sender *SMTPSender) handshake(client *smtp.Client) error {
+	if sender.config.HELO != "" {
+		if err := client.Hello(sender.config.HELO); err != nil {
+			return err
+		}
+	}
+
+	if sender.config.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported
+		}
+		if err := client.StartTLS(sender.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if sender.auth != nil {
+		if err := client.Auth(sender.auth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sender *SMTPSender) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+	if sender.config.TLSConfig != nil {
+		config = sender.config.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = sender.config.Host
+	}
+
+	return config
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp lacks but some
+// providers still require.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like smtp.PlainAuth, never send the password in clear text
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return AuthLogin, nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("mail: unexpected LOGIN challenge %q", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,227 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSMTPConfig(server *fakeSMTPServer, tlsConfig *tls.Config) SMTPConfig {
+	return SMTPConfig{
+		Host:        "127.0.0.1",
+		Port:        server.port(),
+		Username:    "user",
+		Password:    "secret",
+		TLSConfig:   tlsConfig,
+		FromName:    "Mata Duitan",
+		FromAddress: "noreply@example.com",
+		Timeout:     5 * time.Second,
+	}
+}
+
+func sendTestEmail(sender *SMTPSender) error {
+	return sender.SendEmail(
+		context.Background(),
+		"OTP Request",
+		Body{Text: "Your OTP code is 123456", HTML: "<b>123456</b>"},
+		[]string{"user@example.com"},
+		[]string{"Support <support@example.com>"},
+		[]string{"audit@example.com"},
+		nil,
+	)
+}
+
+func TestSMTPSenderStartTLSWithPlainAuth(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, nil)
+
+	config := testSMTPConfig(server, tlsConfig)
+	config.ReplyTo = "support@example.com"
+	sender, err := NewSMTPSender(config, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, sendTestEmail(sender))
+
+	messages := server.received()
+	require.Len(t, messages, 1)
+	msg := messages[0]
+	assert.True(t, msg.tls)
+	assert.Equal(t, AuthPlain, msg.mechanism)
+	assert.Equal(t, "user", msg.username)
+	assert.Equal(t, "noreply@example.com", msg.from)
+	assert.Equal(t, []string{"user@example.com", "support@example.com", "audit@example.com"}, msg.recipients)
+
+	header, body := readMessage(t, msg.data)
+	from, err := netmail.ParseAddress(header.Get("From"))
+	require.NoError(t, err)
+	assert.Equal(t, "Mata Duitan", from.Name)
+	assert.Equal(t, "noreply@example.com", from.Address)
+	assert.Equal(t, "support@example.com", header.Get("Reply-To"))
+	assert.Equal(t, "user@example.com", header.Get("To"))
+	assert.Empty(t, header.Get("Bcc"))
+	assert.Equal(t, "OTP Request", header.Get("Subject"))
+	parts := leafParts(t, header, strings.NewReader(body))
+	require.Len(t, parts, 2)
+	assert.Contains(t, parts[0].header.Get("Content-Type"), "text/plain")
+	assert.Equal(t, "Your OTP code is 123456", parts[0].body)
+	assert.Contains(t, parts[1].header.Get("Content-Type"), "text/html")
+	assert.Equal(t, "<b>123456</b>", parts[1].body)
+}
+
+func TestSMTPSenderMultipartAlternative(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, nil)
+
+	sender, err := NewSMTPSender(testSMTPConfig(server, tlsConfig), nil)
+	require.NoError(t, err)
+
+	send := func(body Body) []mimePart {
+		err := sender.SendEmail(context.Background(), "OTP Request", body, []string{"user@example.com"}, nil, nil, nil)
+		require.NoError(t, err)
+
+		messages := server.received()
+		header, raw := readMessage(t, messages[len(messages)-1].data)
+		return leafParts(t, header, strings.NewReader(raw))
+	}
+
+	// The text part is generated from HTML when missing
+	parts := send(Body{HTML: "<p>Your OTP code is <b>123456</b></p>"})
+	require.Len(t, parts, 2)
+	assert.Equal(t, "Your OTP code is 123456", parts[0].body)
+
+	// Text only is sent without an alternative
+	parts = send(Body{Text: "Your OTP code is 123456"})
+	require.Len(t, parts, 1)
+	assert.Contains(t, parts[0].header.Get("Content-Type"), "text/plain")
+
+	err = sender.SendEmail(context.Background(), "OTP Request", Body{}, []string{"user@example.com"}, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrEmptyBody)
+}
+
+func TestSMTPSenderImplicitTLSWithLoginAuth(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, func(s *fakeSMTPServer) {
+		s.implicitTLS = true
+		s.mechanisms = []string{AuthLogin}
+	})
+
+	config := testSMTPConfig(server, tlsConfig)
+	config.TLS = TLSImplicit
+	config.Auth = AuthLogin
+	sender, err := NewSMTPSender(config, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, sendTestEmail(sender))
+
+	messages := server.received()
+	require.Len(t, messages, 1)
+	assert.True(t, messages[0].tls)
+	assert.Equal(t, AuthLogin, messages[0].mechanism)
+}
+
+func TestSMTPSenderPlainConnectionWithCRAMMD5AndHELO(t *testing.T) {
+	server, _ := startFakeSMTPServer(t, func(s *fakeSMTPServer) {
+		s.startTLS = false
+	})
+
+	config := testSMTPConfig(server, nil)
+	config.TLS = TLSNone
+	config.Auth = AuthCRAMMD5
+	config.HELO = "mail.example.com"
+	sender, err := NewSMTPSender(config, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, sendTestEmail(sender))
+
+	messages := server.received()
+	require.Len(t, messages, 1)
+	assert.False(t, messages[0].tls)
+	assert.Equal(t, AuthCRAMMD5, messages[0].mechanism)
+	assert.Equal(t, "mail.example.com", messages[0].helo)
+}
+
+func TestSMTPSenderRequiresStartTLS(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, func(s *fakeSMTPServer) {
+		s.startTLS = false
+	})
+
+	sender, err := NewSMTPSender(testSMTPConfig(server, tlsConfig), nil)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, sendTestEmail(sender), ErrStartTLSUnsupported)
+	assert.Empty(t, server.received())
+}
+
+func TestSMTPSenderRejectedCredentials(t *testing.T) {
+	server, tlsConfig := startFakeSMTPServer(t, nil)
+
+	config := testSMTPConfig(server, tlsConfig)
+	config.Password = "wrong"
+	sender, err := NewSMTPSender(config, nil)
+	require.NoError(t, err)
+
+	assert.Error(t, sendTestEmail(sender))
+	assert.Empty(t, server.received())
+}
+
+func TestSMTPSenderTimeout(t *testing.T) {
+	// Accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	sender, err := NewSMTPSender(SMTPConfig{
+		Host:        "127.0.0.1",
+		Port:        listener.Addr().(*net.TCPAddr).Port,
+		FromAddress: "noreply@example.com",
+		Timeout:     100 * time.Millisecond,
+	}, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = sendTestEmail(sender)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestNewSMTPSenderValidatesConfig(t *testing.T) {
+	valid := SMTPConfig{Host: "smtp.example.com", Port: 587, Username: "user@example.com"}
+
+	sender, err := NewSMTPSender(valid, nil)
+	require.NoError(t, err)
+	assert.Equal(t, TLSStartTLS, sender.config.TLS)
+	assert.Equal(t, AuthPlain, sender.config.Auth)
+	assert.Equal(t, "user@example.com", sender.config.FromAddress)
+
+	tests := map[string]func(c *SMTPConfig){
+		"missing host":      func(c *SMTPConfig) { c.Host = "" },
+		"missing port":      func(c *SMTPConfig) { c.Port = 0 },
+		"missing from":      func(c *SMTPConfig) { c.Username = "" },
+		"unknown tls mode":  func(c *SMTPConfig) { c.TLS = "ssl" },
+		"unknown mechanism": func(c *SMTPConfig) { c.Auth = "XOAUTH2" },
+	}
+
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := valid
+			change(&config)
+
+			_, err := NewSMTPSender(config, nil)
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+}
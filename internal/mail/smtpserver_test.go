@@ -0,0 +1,332 @@
+package mail
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// received is one message accepted by the fake SMTP server, together with
+// how the session that delivered it was set up.
+type received struct {
+	helo       string
+	tls        bool
+	mechanism  string
+	username   string
+	from       string
+	recipients []string
+	data       string
+}
+
+// fakeSMTPServer is a minimal in-process SMTP server. It speaks just enough
+// ESMTP for net/smtp: EHLO, STARTTLS, AUTH PLAIN/LOGIN/CRAM-MD5, MAIL, RCPT,
+// DATA, RSET, NOOP and QUIT. Recipients in rejected are refused, and with
+// hangUpAfter the connection is dropped after that many messages.
+type fakeSMTPServer struct {
+	listener net.Listener
+	tls      *tls.Config
+
+	implicitTLS bool
+	startTLS    bool
+	mechanisms  []string
+	username    string
+	password    string
+	rejected    map[string]bool
+	hangUpAfter int
+
+	mu       sync.Mutex
+	messages []received
+	sessions int
+	active   int
+}
+
+// startFakeSMTPServer starts a server configured by configure and returns it
+// together with a client TLS config that trusts its certificate.
+func startFakeSMTPServer(t testing.TB, configure func(s *fakeSMTPServer)) (*fakeSMTPServer, *tls.Config) {
+	certificate, roots := testCertificate(t)
+
+	s := &fakeSMTPServer{
+		tls:        &tls.Config{Certificates: []tls.Certificate{certificate}},
+		startTLS:   true,
+		mechanisms: []string{AuthPlain, AuthLogin, AuthCRAMMD5},
+		username:   "user",
+		password:   "secret",
+	}
+	if configure != nil {
+		configure(s)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if s.implicitTLS {
+		listener = tls.NewListener(listener, s.tls)
+	}
+	s.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s, &tls.Config{RootCAs: roots}
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) received() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received{}, s.messages...)
+}
+
+// sessionCount returns how many connections were accepted and how many of
+// them are still open.
+func (s *fakeSMTPServer) sessionCount() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions, s.active
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	s.mu.Lock()
+	s.sessions++
+	s.active++
+	s.mu.Unlock()
+
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	accepted := 0
+
+	_, encrypted := conn.(*tls.Conn)
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP ready")
+
+	var session received
+	session.tls = encrypted
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			session.helo = arg
+			text.PrintfLine("250-fake greets %s", arg)
+			if s.startTLS && !session.tls {
+				text.PrintfLine("250-STARTTLS")
+			}
+			if len(s.mechanisms) > 0 {
+				text.PrintfLine("250-AUTH %s", strings.Join(s.mechanisms, " "))
+			}
+			text.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			session = received{tls: true}
+		case "AUTH":
+			if !s.auth(text, arg, &session) {
+				text.PrintfLine("535 authentication failed")
+				continue
+			}
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			session.from = trimPath(arg, "FROM:")
+			session.recipients = nil
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			recipient := trimPath(arg, "TO:")
+			if s.rejected[recipient] {
+				text.PrintfLine("550 mailbox unavailable")
+				continue
+			}
+			session.recipients = append(session.recipients, recipient)
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			session.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, session)
+			s.mu.Unlock()
+			session.from, session.recipients, session.data = "", nil, ""
+			text.PrintfLine("250 queued")
+
+			// Like servers limiting messages per connection, or dropping
+			// idle clients
+			accepted++
+			if s.hangUpAfter > 0 && accepted >= s.hangUpAfter {
+				return
+			}
+		case "RSET":
+			session.from, session.recipients = "", nil
+			text.PrintfLine("250 ok")
+		case "NOOP":
+			text.PrintfLine("250 ok")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// auth runs one AUTH exchange and reports whether the credentials matched.
+func (s *fakeSMTPServer) auth(text *textproto.Conn, arg string, session *received) bool {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	mechanism = strings.ToUpper(mechanism)
+
+	challenge := func(prompt string) (string, bool) {
+		text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := text.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		return string(decoded), err == nil
+	}
+
+	var username string
+	var ok bool
+
+	switch mechanism {
+	case AuthPlain:
+		response := initial
+		if response == "" {
+			text.PrintfLine("334 ")
+			response, _ = text.ReadLine()
+		}
+		decoded, err := base64.StdEncoding.DecodeString(response)
+		if err != nil {
+			return false
+		}
+		parts := strings.Split(string(decoded), "\x00")
+		if len(parts) != 3 {
+			return false
+		}
+		username = parts[1]
+		ok = parts[1] == s.username && parts[2] == s.password
+	case AuthLogin:
+		var password string
+		if username, ok = challenge("Username:"); !ok {
+			return false
+		}
+		if password, ok = challenge("Password:"); !ok {
+			return false
+		}
+		ok = username == s.username && password == s.password
+	case AuthCRAMMD5:
+		nonce := "<1896.697170952@fake>"
+		response, valid := challenge(nonce)
+		if !valid {
+			return false
+		}
+		name, digest, _ := strings.Cut(response, " ")
+		mac := hmac.New(md5.New, []byte(s.password))
+		mac.Write([]byte(nonce))
+		username = name
+		ok = name == s.username && digest == hex.EncodeToString(mac.Sum(nil))
+	default:
+		return false
+	}
+
+	if ok {
+		session.mechanism = mechanism
+		session.username = username
+	}
+	return ok
+}
+
+func trimPath(arg string, prefix string) string {
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	arg, _, _ = strings.Cut(arg, " ")
+	return strings.Trim(arg, "<>")
+}
+
+// testCertificate creates a self-signed certificate for 127.0.0.1 and
+// localhost and a pool that trusts it.
+func testCertificate(t testing.TB) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}
+
+// readMessage splits received data into headers and body.
+func readMessage(t testing.TB, data string) (textproto.MIMEHeader, string) {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	header, err := reader.ReadMIMEHeader()
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(reader.R)
+	require.NoError(t, err)
+
+	return header, string(body)
+}
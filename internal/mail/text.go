@@ -0,0 +1,159 @@
+package mail
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText renders an HTML email as plain text for the text/plain
+// alternative: markup, styles and comments are dropped, blocks become
+// paragraphs, list items are prefixed with "- " and links are followed by
+// their URL.
+func HTMLToText(content string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	w := &textWriter{}
+	w.walk(doc)
+
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+type textWriter struct {
+	b      strings.Builder
+	breaks int
+	space  bool
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.CommentNode:
+		return
+	case html.ElementNode:
+		if hidden(n) {
+			return
+		}
+		switch n.DataAtom {
+		case atom.Head, atom.Script, atom.Style, atom.Title:
+			return
+		case atom.Br:
+			w.breaks++
+			return
+		case atom.Img:
+			w.text(attr(n, "alt"))
+			return
+		case atom.Td, atom.Th:
+			w.space = true
+		}
+	}
+
+	paragraph, line := blockBreaks(n)
+	w.lineBreak(paragraph, line)
+	if n.DataAtom == atom.Li {
+		w.flush()
+		w.b.WriteString("- ")
+	}
+
+	start := w.b.Len()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+
+	// Show where a link goes unless its text already is the URL
+	if n.DataAtom == atom.A {
+		href := strings.TrimSpace(attr(n, "href"))
+		label := strings.TrimSpace(w.b.String()[start:])
+		if href != "" && !strings.HasPrefix(href, "#") && href != label {
+			w.text(" (" + href + ")")
+		}
+	}
+
+	w.lineBreak(paragraph, line)
+}
+
+func (w *textWriter) text(s string) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			w.space = true
+		}
+		return
+	}
+
+	first, _ := utf8.DecodeRuneInString(s)
+	if unicode.IsSpace(first) {
+		w.space = true
+	}
+	w.flush()
+	w.b.WriteString(strings.Join(words, " "))
+
+	last, _ := utf8.DecodeLastRuneInString(s)
+	w.space = unicode.IsSpace(last)
+}
+
+// flush writes the pending line breaks or space before the next text.
+func (w *textWriter) flush() {
+	if w.b.Len() > 0 {
+		if w.breaks > 0 {
+			w.b.WriteString(strings.Repeat("\n", w.breaks))
+		} else if w.space {
+			w.b.WriteString(" ")
+		}
+	}
+	w.breaks, w.space = 0, false
+}
+
+func (w *textWriter) lineBreak(paragraph bool, line bool) {
+	switch {
+	case paragraph && w.breaks < 2:
+		w.breaks = 2
+	case line && w.breaks < 1:
+		w.breaks = 1
+	}
+}
+
+func blockBreaks(n *html.Node) (paragraph bool, line bool) {
+	if n.Type != html.ElementNode {
+		return false, false
+	}
+
+	switch n.DataAtom {
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Table, atom.Blockquote, atom.Pre, atom.Hr:
+		return true, false
+	case atom.Div, atom.Tr, atom.Li, atom.Section, atom.Header, atom.Footer, atom.Center:
+		return false, true
+	}
+
+	return false, false
+}
+
+// hidden reports inline-styled elements that are not displayed, such as
+// preheaders.
+func hidden(n *html.Node) bool {
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		text string
+	}{
+		{
+			name: "inline markup",
+			html: "<p>Your OTP code is <b>123456</b>.</p>",
+			text: "Your OTP code is 123456.",
+		},
+		{
+			name: "head, styles and comments",
+			html: "<html><head><title>OTP</title><style>p { margin: 0 }</style></head><body><!--[if mso]>outlook<![endif]--><p>Hello</p></body></html>",
+			text: "Hello",
+		},
+		{
+			name: "paragraphs and line breaks",
+			html: "<h1>Welcome</h1><p>First line<br>second line</p><div>Footer</div>",
+			text: "Welcome\n\nFirst line\nsecond line\n\nFooter",
+		},
+		{
+			name: "links",
+			html: `<a href="https://example.com/verify">Confirm your email</a> or <a href="https://example.com">https://example.com</a> <a href="">Unsubscribe</a>`,
+			text: "Confirm your email (https://example.com/verify) or https://example.com Unsubscribe",
+		},
+		{
+			name: "lists",
+			html: "<p>Steps:</p><ul><li>Open the app</li><li>Enter the code</li></ul>",
+			text: "Steps:\n\n- Open the app\n- Enter the code",
+		},
+		{
+			name: "tables and images",
+			html: `<table><tr><td><img src="cid:logo" alt="Mata Duitan"></td><td>Total</td><td>10</td></tr></table>`,
+			text: "Mata Duitan Total 10",
+		},
+		{
+			name: "hidden preheader",
+			html: `<div style="display: none">Preview text</div><p>Body</p>`,
+			text: "Body",
+		},
+		{
+			name: "whitespace",
+			html: "<p>\n    Your   OTP\n    code\n</p>",
+			text: "Your OTP code",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := HTMLToText(tt.html)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.text, text)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package notification
+
+// Routing keys follow notification.<channel>.<event>, so a worker can bind to
+// a whole channel ("notification.email.*") or to every event of one kind
+// ("notification.*.alert").
+const (
+	Exchange     = "notification"
+	ExchangeType = "topic"
+
+	RoutingKeyEmailOTP   = "notification.email.otp"
+	RoutingKeySMSAlert   = "notification.sms.alert"
+	BindingKeyEmailAll   = "notification.email.*"
+	BindingKeySMSAll     = "notification.sms.*"
+	BindingKeyAlertAll   = "notification.*.alert"
+	BindingKeyEverything = "notification.#"
+)
@@ -0,0 +1,24 @@
+package notification
+
+import queueclient "go_project_template/configs/queue_client"
+
+// MailQueue is declared by both the user service and the notification worker,
+// so both have to use the same options below. RabbitMQ rejects a redeclare
+// with different arguments, so an existing mailQueue has to be deleted
+// before any of them change.
+const MailQueue = "mailQueue"
+
+var ExchangeOptions = queueclient.ExchangeOptions{
+	Durable: true,
+}
+
+// MailQueueOptions keeps mail across broker restarts. It stays a classic
+// queue because quorum queues cannot prioritise, and rejects publishes once
+// full so the outbox relay retries instead of mail being dropped.
+var MailQueueOptions = queueclient.QueueOptions{
+	Durable:     true,
+	Type:        queueclient.QueueTypeClassic,
+	MaxLength:   1000000,
+	Overflow:    queueclient.OverflowRejectPublish,
+	MaxPriority: MaxPriority,
+}
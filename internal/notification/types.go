@@ -0,0 +1,18 @@
+package notification
+
+// Message types carried in the envelope of every notification event. Bump
+// the version when a payload changes incompatibly and register a handler for
+// both versions until old messages are drained.
+const (
+	TypeEmailOTP        = "email.otp"
+	TypeEmailOTPVersion = 1
+)
+
+// Priorities of notification messages. Transactional messages such as OTPs
+// are waited on by a user and jump ahead of bulk sends like campaigns.
+const (
+	PriorityBulk          uint8 = 1
+	PriorityTransactional uint8 = 9
+
+	MaxPriority uint8 = 10
+)
@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"go_project_template/configs/db"
+	queueclient "go_project_template/configs/queue_client"
+	"time"
+)
+
+// Event is a message waiting in the outbox to be published with RoutingKey,
+// not before AvailableAt when it is set.
+type Event struct {
+	RoutingKey  string
+	Envelope    queueclient.Envelope
+	AvailableAt time.Time
+}
+
+func NewEvent(routingKey string, msgType string, version int, payload interface{}) (Event, error) {
+	envelope, err := queueclient.NewEnvelope(msgType, version, payload)
+
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		RoutingKey: routingKey,
+		Envelope:   envelope,
+	}, nil
+}
+
+// Execer is satisfied by *sql.DB and *sql.Tx, so events can be written in the
+// transaction of the change they describe.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Insert writes events to the outbox table. Pass the transaction of the state
+// change to publish its events if and only if it commits.
+func Insert(ctx context.Context, exec Execer, events ...Event) error {
+	sqlStatement := `
+	INSERT INTO
+		"user".outbox(message_id, routing_key, message_type, version, correlation_id, tenant, locale, priority, payload, created_at, available_at)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE($11, now()))
+	`
+
+	for _, event := range events {
+		env := event.Envelope
+		availableAt := sql.NullTime{
+			Time:  event.AvailableAt,
+			Valid: !event.AvailableAt.IsZero(),
+		}
+
+		_, err := exec.ExecContext(ctx, sqlStatement,
+			env.ID,
+			event.RoutingKey,
+			env.Type,
+			env.Version,
+			env.CorrelationID,
+			env.Tenant,
+			env.Locale,
+			int(env.Priority),
+			[]byte(env.Payload),
+			env.CreatedAt,
+			availableAt,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type IOutboxRepository interface {
+	Enqueue(ctx context.Context, events ...Event) error
+}
+
+type OutboxRepository struct {
+	db db.DBInterface
+}
+
+func NewOutboxRepository(db db.DBInterface) *OutboxRepository {
+	return &OutboxRepository{
+		db: db,
+	}
+}
+
+// Enqueue writes events on their own, for changes that live outside Postgres.
+func (r *OutboxRepository) Enqueue(ctx context.Context, events ...Event) error {
+	return db.Transaction(ctx, r.db, func(tx *sql.Tx) error {
+		return Insert(ctx, tx, events...)
+	})
+}
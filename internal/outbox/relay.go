@@ -0,0 +1,309 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"go_project_template/configs/db"
+	queueclient "go_project_template/configs/queue_client"
+	"log"
+	"time"
+)
+
+const (
+	defaultRelayInterval  = time.Second
+	defaultRelayBatchSize = 100
+	defaultRelayRetention = 7 * 24 * time.Hour
+	defaultRelayLease     = 5 * time.Minute
+
+	defaultRelayMaxAttempt      = 20
+	defaultRelayInitialInterval = time.Second
+	defaultRelayMaxInterval     = 10 * time.Minute
+
+	cleanupInterval = time.Hour
+	recordTimeout   = 10 * time.Second
+)
+
+// RelayConfig controls how often the outbox is polled and how long sent rows
+// are kept for troubleshooting before they are deleted. Retry sets how often
+// and how far apart a row is published again after a failure, Lease how long
+// a relay holds the rows it claimed; it should outlast the publish of a whole
+// batch, including the reconnect window of the publisher.
+type RelayConfig struct {
+	Interval  time.Duration
+	BatchSize int
+	Retention time.Duration
+	Lease     time.Duration
+	Retry     queueclient.RetryConfig
+}
+
+// Relay publishes pending outbox rows and marks them sent. Rows scheduled for
+// later are skipped until they are due, cancelled rows for good. A relay
+// claims its batch with a lease in a short transaction and publishes outside
+// of it, so several relays can run against the same table without holding
+// locks while the broker is slow. A row that fails to publish is retried
+// with backoff and marked failed after Retry.MaxAttempt attempts, without
+// holding up the rows behind it. Delivery is at least once: a crash between
+// the publish and marking the row sent publishes it again once the lease
+// expires.
+type Relay struct {
+	config    RelayConfig
+	db        db.DBInterface
+	publisher queueclient.Publisher
+}
+
+func NewRelay(config RelayConfig, db db.DBInterface, publisher queueclient.Publisher) *Relay {
+	if config.Interval <= 0 {
+		config.Interval = defaultRelayInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultRelayBatchSize
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaultRelayRetention
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaultRelayLease
+	}
+	if config.Retry.MaxAttempt <= 0 {
+		config.Retry.MaxAttempt = defaultRelayMaxAttempt
+	}
+	if config.Retry.InitialInterval <= 0 {
+		config.Retry.InitialInterval = defaultRelayInitialInterval
+	}
+	if config.Retry.MaxInterval <= 0 {
+		config.Retry.MaxInterval = defaultRelayMaxInterval
+	}
+
+	return &Relay{
+		config:    config,
+		db:        db,
+		publisher: publisher,
+	}
+}
+
+// Start relays the outbox until ctx is cancelled. Scheduled rows are
+// published on the first poll after they are due, so Interval is also their
+// delivery precision.
+func (r *Relay) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+
+	for {
+		sent, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Println("Failed to relay outbox:", err)
+		}
+
+		if time.Since(lastCleanup) > cleanupInterval {
+			if err := r.cleanup(ctx); err != nil && ctx.Err() == nil {
+				log.Println("Failed to clean up outbox:", err)
+			}
+			lastCleanup = time.Now()
+		}
+
+		// A full batch means more rows are probably waiting
+		if err == nil && sent == r.config.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+type pendingEvent struct {
+	id       int64
+	attempts int
+	Event
+}
+
+// RelayBatch publishes up to BatchSize pending rows and returns how many were
+// sent. A failed publish is recorded on its row, which is retried after the
+// backoff of Retry, and the batch goes on with the next row.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	events, err := r.claim(ctx)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	publishErrs := make([]error, len(events))
+	for i, event := range events {
+		if ctx.Err() != nil {
+			publishErrs[i] = ctx.Err()
+			continue
+		}
+		publishErrs[i] = r.publisher.Publish(ctx, event.RoutingKey, event.Envelope)
+	}
+
+	// The outcome is recorded even when ctx was cancelled meanwhile, so the
+	// rows published are not sent again once their lease expires
+	recordCtx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+
+	sent := 0
+	err = db.Transaction(recordCtx, r.db, func(tx *sql.Tx) error {
+		for i, event := range events {
+			var err error
+
+			switch publishErr := publishErrs[i]; {
+			case publishErr == nil:
+				err = markSent(recordCtx, tx, event)
+				sent++
+			case ctx.Err() != nil:
+				err = release(recordCtx, tx, event)
+			default:
+				err = r.markFailed(recordCtx, tx, event, publishErr)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+// claim leases up to BatchSize due rows to this relay. Rows leased by another
+// relay, waiting for their next attempt or failed for good are skipped.
+func (r *Relay) claim(ctx context.Context) ([]pendingEvent, error) {
+	queryStatement := `
+	UPDATE "user".outbox
+	SET locked_until = $2
+	WHERE id IN (
+		SELECT id
+		FROM "user".outbox
+		WHERE sent_at IS NULL
+			AND cancelled_at IS NULL
+			AND failed_at IS NULL
+			AND available_at <= now()
+			AND (next_attempt_at IS NULL OR next_attempt_at <= now())
+			AND (locked_until IS NULL OR locked_until < now())
+		ORDER BY available_at, id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING
+		id,
+		attempts,
+		message_id,
+		routing_key,
+		message_type,
+		version,
+		correlation_id,
+		tenant,
+		locale,
+		priority,
+		payload,
+		created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, queryStatement, r.config.BatchSize, time.Now().Add(r.config.Lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []pendingEvent
+	for rows.Next() {
+		var event pendingEvent
+		var priority int
+		var payload []byte
+
+		err := rows.Scan(
+			&event.id,
+			&event.attempts,
+			&event.Envelope.ID,
+			&event.RoutingKey,
+			&event.Envelope.Type,
+			&event.Envelope.Version,
+			&event.Envelope.CorrelationID,
+			&event.Envelope.Tenant,
+			&event.Envelope.Locale,
+			&priority,
+			&payload,
+			&event.Envelope.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		event.Envelope.Priority = uint8(priority)
+		event.Envelope.Payload = payload
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func markSent(ctx context.Context, tx *sql.Tx, event pendingEvent) error {
+	_, err := tx.ExecContext(ctx, `
+	UPDATE "user".outbox
+	SET sent_at = now(), attempts = attempts + 1, last_error = NULL, locked_until = NULL
+	WHERE id = $1
+	`, event.id)
+
+	return err
+}
+
+// markFailed schedules the next attempt of the row, or marks it failed when it
+// has run out of attempts. Failed rows stay in the table until Retention has
+// passed; clearing failed_at and attempts sends them again.
+func (r *Relay) markFailed(ctx context.Context, tx *sql.Tx, event pendingEvent, publishErr error) error {
+	attempts := event.attempts + 1
+	giveUp := attempts >= r.config.Retry.MaxAttempt
+	nextAttempt := time.Now().Add(r.config.Retry.Backoff(attempts))
+
+	_, err := tx.ExecContext(ctx, `
+	UPDATE "user".outbox
+	SET
+		attempts = $2,
+		last_error = $3,
+		next_attempt_at = $4,
+		failed_at = CASE WHEN $5 THEN now() END,
+		locked_until = NULL
+	WHERE id = $1
+	`, event.id, attempts, publishErr.Error(), nextAttempt, giveUp)
+
+	if err != nil {
+		return err
+	}
+
+	if giveUp {
+		log.Printf("Failed to publish outbox event %d after %d attempts, giving up: %s", event.id, attempts, publishErr)
+	} else {
+		log.Printf("Failed to publish outbox event %d, retrying at %s: %s", event.id, nextAttempt.Format(time.RFC3339), publishErr)
+	}
+	return nil
+}
+
+// release hands back a row that was claimed but not published, so the next
+// poll can take it without waiting for the lease to expire.
+func release(ctx context.Context, tx *sql.Tx, event pendingEvent) error {
+	_, err := tx.ExecContext(ctx, `
+	UPDATE "user".outbox
+	SET locked_until = NULL
+	WHERE id = $1
+	`, event.id)
+
+	return err
+}
+
+func (r *Relay) cleanup(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `
+	DELETE FROM "user".outbox
+	WHERE sent_at < $1 OR cancelled_at < $1 OR failed_at < $1
+	`, time.Now().Add(-r.config.Retention))
+
+	return err
+}
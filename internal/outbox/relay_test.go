@@ -0,0 +1,150 @@
+package outbox_test
+
+import (
+	"context"
+	"database/sql/driver"
+	queueclient "go_project_template/configs/queue_client"
+	"go_project_template/internal/outbox"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pendingColumns = []string{
+	"id",
+	"attempts",
+	"message_id",
+	"routing_key",
+	"message_type",
+	"version",
+	"correlation_id",
+	"tenant",
+	"locale",
+	"priority",
+	"payload",
+	"created_at",
+}
+
+// afterNow matches a time about d from now.
+type afterNow time.Duration
+
+func (d afterNow) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	expected := time.Now().Add(time.Duration(d))
+	return at.After(expected.Add(-time.Minute)) && at.Before(expected.Add(time.Minute))
+}
+
+func TestRelayBatchPublishesAndMarksSent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	broker := queueclient.NewMemoryBroker()
+	broker.DeclareQueue("mailQueue", "notification.email.*")
+
+	rows := sqlmock.NewRows(pendingColumns).
+		AddRow(int64(1), 0, "msg-1", "notification.email.otp", "email.otp", 1, "", "", "", 0, []byte(`{"email":"a@mail.com"}`), time.Now()).
+		AddRow(int64(2), 0, "msg-2", "notification.email.otp", "email.otp", 1, "", "", "", 0, []byte(`{"email":"b@mail.com"}`), time.Now())
+
+	// The rows are claimed before the transaction that records the publish
+	mock.ExpectQuery(`UPDATE "user".outbox\s+SET locked_until = \$2`).
+		WithArgs(10, afterNow(5*time.Minute)).
+		WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET sent_at = now\(\)`).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET sent_at = now\(\)`).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	relay := outbox.NewRelay(outbox.RelayConfig{BatchSize: 10}, db, broker)
+	sent, err := relay.RelayBatch(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, 2, broker.Pending("mailQueue"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBatchBacksOffFailedPublishAndGoesOn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Only email is bound, so the push event is unroutable
+	broker := queueclient.NewMemoryBroker()
+	broker.DeclareQueue("mailQueue", "notification.email.*")
+
+	rows := sqlmock.NewRows(pendingColumns).
+		AddRow(int64(1), 1, "msg-1", "notification.push.otp", "push.otp", 1, "", "", "", 0, []byte(`{}`), time.Now()).
+		AddRow(int64(2), 0, "msg-2", "notification.email.otp", "email.otp", 1, "", "", "", 0, []byte(`{}`), time.Now())
+
+	mock.ExpectQuery(`UPDATE "user".outbox\s+SET locked_until`).WithArgs(10, sqlmock.AnyArg()).WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET\s+attempts = \$2,\s+last_error = \$3,\s+next_attempt_at = \$4`).
+		WithArgs(int64(1), 2, sqlmock.AnyArg(), afterNow(2*time.Minute), false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET sent_at = now\(\)`).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	relay := outbox.NewRelay(outbox.RelayConfig{
+		BatchSize: 10,
+		Retry:     queueclient.RetryConfig{MaxAttempt: 5, InitialInterval: time.Minute, Multiplier: 2},
+	}, db, broker)
+	sent, err := relay.RelayBatch(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 1, broker.Pending("mailQueue"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBatchGivesUpAfterMaxAttempt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Nothing is bound, so every publish is unroutable
+	broker := queueclient.NewMemoryBroker()
+
+	rows := sqlmock.NewRows(pendingColumns).
+		AddRow(int64(1), 2, "msg-1", "notification.email.otp", "email.otp", 1, "", "", "", 0, []byte(`{}`), time.Now())
+
+	mock.ExpectQuery(`UPDATE "user".outbox\s+SET locked_until`).WithArgs(10, sqlmock.AnyArg()).WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectExec(`failed_at = CASE WHEN \$5 THEN now\(\) END`).
+		WithArgs(int64(1), 3, sqlmock.AnyArg(), sqlmock.AnyArg(), true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	relay := outbox.NewRelay(outbox.RelayConfig{
+		BatchSize: 10,
+		Retry:     queueclient.RetryConfig{MaxAttempt: 3},
+	}, db, broker)
+	sent, err := relay.RelayBatch(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBatchWithNothingDue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`UPDATE "user".outbox\s+SET locked_until`).
+		WithArgs(10, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(pendingColumns))
+
+	relay := outbox.NewRelay(outbox.RelayConfig{BatchSize: 10}, db, queueclient.NewMemoryBroker())
+	sent, err := relay.RelayBatch(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"context"
+	"go_project_template/configs/db"
+	queueclient "go_project_template/configs/queue_client"
+	"time"
+)
+
+// Scheduler publishes through the outbox, so a message can be held back until
+// a given time and cancelled until the Relay has sent it. It is the
+// ScheduledPublisher to use with RabbitMQ and Redis Streams, whose publishers
+// cannot hold messages back, and relies on the Relay running on the same
+// database.
+type Scheduler struct {
+	db db.DBInterface
+}
+
+func NewScheduler(db db.DBInterface) *Scheduler {
+	return &Scheduler{
+		db: db,
+	}
+}
+
+var _ queueclient.ScheduledPublisher = (*Scheduler)(nil)
+
+func (s *Scheduler) Publish(ctx context.Context, routingKey string, env queueclient.Envelope) error {
+	return Insert(ctx, s.db, Event{RoutingKey: routingKey, Envelope: env})
+}
+
+func (s *Scheduler) PublishAt(ctx context.Context, routingKey string, env queueclient.Envelope, at time.Time) error {
+	return Insert(ctx, s.db, Event{RoutingKey: routingKey, Envelope: env, AvailableAt: at})
+}
+
+func (s *Scheduler) PublishAfter(ctx context.Context, routingKey string, env queueclient.Envelope, delay time.Duration) error {
+	return s.PublishAt(ctx, routingKey, env, time.Now().Add(delay))
+}
+
+// Cancel drops a scheduled message by its envelope ID. A message the Relay
+// has claimed for publishing is past cancelling, Cancel reports
+// ErrNotScheduled for it.
+func (s *Scheduler) Cancel(ctx context.Context, messageID string) error {
+	updateStatement := `
+	UPDATE "user".outbox
+	SET cancelled_at = now()
+	WHERE message_id = $1
+		AND sent_at IS NULL
+		AND cancelled_at IS NULL
+		AND (locked_until IS NULL OR locked_until < now())
+	`
+
+	res, err := s.db.ExecContext(ctx, updateStatement, messageID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return queueclient.ErrNotScheduled
+	}
+
+	return nil
+}
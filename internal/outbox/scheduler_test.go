@@ -0,0 +1,48 @@
+package outbox_test
+
+import (
+	"context"
+	"database/sql"
+	queueclient "go_project_template/configs/queue_client"
+	"go_project_template/internal/outbox"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerPublishAtStoresDueTime(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	env, err := queueclient.NewEnvelope("email.trial_ending", 1, map[string]string{"email": "a@mail.com"})
+	require.NoError(t, err)
+	at := time.Now().Add(24 * time.Hour)
+
+	mock.ExpectExec(`INSERT INTO\s+"user".outbox`).
+		WithArgs(env.ID, "notification.email.trial_ending", "email.trial_ending", 1, "", "", "", 0, []byte(env.Payload), env.CreatedAt, at).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	scheduler := outbox.NewScheduler(db)
+	require.NoError(t, scheduler.PublishAt(context.Background(), "notification.email.trial_ending", env, at))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(`SET cancelled_at = now\(\)`).WithArgs("msg-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET cancelled_at = now\(\)`).WithArgs("msg-2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SET cancelled_at = now\(\)`).WithArgs("msg-3").WillReturnError(sql.ErrConnDone)
+
+	scheduler := outbox.NewScheduler(db)
+	assert.NoError(t, scheduler.Cancel(context.Background(), "msg-1"))
+	assert.ErrorIs(t, scheduler.Cancel(context.Background(), "msg-2"), queueclient.ErrNotScheduled)
+	assert.ErrorIs(t, scheduler.Cancel(context.Background(), "msg-3"), sql.ErrConnDone)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
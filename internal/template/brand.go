@@ -0,0 +1,52 @@
+package template
+
+import "os"
+
+// Brand is shared by every email, templates read it with {{brand.Product}}.
+type Brand struct {
+	Product         string
+	WebsiteURL      string
+	LogoURL         string
+	Address         string
+	SupportEmail    string
+	UnsubscribeURL  string
+	PrimaryColor    string
+	SecondaryColor  string
+	TextColor       string
+	BackgroundColor string
+}
+
+var DefaultBrand = Brand{
+	Product:         "Mata Duitan",
+	LogoURL:         "https://i.imgur.com/KO1vcE9.png",
+	Address:         "Some Firm Ltd, 35 Avenue. City 10115, USA",
+	PrimaryColor:    "#2F67F6",
+	SecondaryColor:  "#333957",
+	TextColor:       "#555555",
+	BackgroundColor: "#f9f9f9",
+}
+
+// BrandFromEnv is DefaultBrand with the BRAND_* variables that are set
+// replacing its fields.
+func BrandFromEnv() Brand {
+	brand := DefaultBrand
+
+	for env, field := range map[string]*string{
+		"BRAND_PRODUCT":          &brand.Product,
+		"BRAND_WEBSITE_URL":      &brand.WebsiteURL,
+		"BRAND_LOGO_URL":         &brand.LogoURL,
+		"BRAND_ADDRESS":          &brand.Address,
+		"BRAND_SUPPORT_EMAIL":    &brand.SupportEmail,
+		"BRAND_UNSUBSCRIBE_URL":  &brand.UnsubscribeURL,
+		"BRAND_PRIMARY_COLOR":    &brand.PrimaryColor,
+		"BRAND_SECONDARY_COLOR":  &brand.SecondaryColor,
+		"BRAND_TEXT_COLOR":       &brand.TextColor,
+		"BRAND_BACKGROUND_COLOR": &brand.BackgroundColor,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+
+	return brand
+}
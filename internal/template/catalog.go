@@ -0,0 +1,59 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"go_project_template/internal/locale"
+)
+
+const localesDir = "locales"
+
+var ErrMissingTranslation = errors.New("template: missing translation")
+
+// catalog maps message keys to the translated text. Messages are fmt
+// formats, so {{t "confirm-email.intro" brand.Product}} fills in %s.
+type catalog map[string]string
+
+// loadCatalog merges locales/<locale>.json of every locale in the fallback
+// chain of loc, so keys missing from "id-ID" come from "id" and then from
+// the default locale.
+func (r *Registry) loadCatalog(loc string) (catalog, error) {
+	messages := catalog{}
+
+	chain := locale.Fallbacks(loc)
+	for i := len(chain) - 1; i >= 0; i-- {
+		file := path.Join(localesDir, chain[i]+".json")
+		data, err := fs.ReadFile(r.files, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var translations map[string]string
+		if err := json.Unmarshal(data, &translations); err != nil {
+			return nil, fmt.Errorf("template: %s: %w", file, err)
+		}
+		for key, message := range translations {
+			messages[key] = message
+		}
+	}
+
+	return messages, nil
+}
+
+func (c catalog) translate(key string, args ...interface{}) (string, error) {
+	message, ok := c[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrMissingTranslation, key)
+	}
+	if len(args) == 0 {
+		return message, nil
+	}
+	return fmt.Sprintf(message, args...), nil
+}
@@ -0,0 +1,107 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go_project_template/internal/locale"
+)
+
+var ErrInvalidTemplate = errors.New("template: invalid template")
+
+// Definition is an email kept outside the template files, such as a version
+// managed through the template API. HTML and Text take the place of
+// emails/<Name>.html and .txt and are rendered with the same layouts,
+// partials and catalogs. Subject is a text template with the same data,
+// "<Name>.subject" of the catalog when empty.
+type Definition struct {
+	Name    string
+	Locale  string
+	Version int
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Source supplies published definitions, see emailtemplate.Cache.
+type Source interface {
+	// Published returns the definition of name published for exactly loc, ok
+	// is false when there is none.
+	Published(ctx context.Context, name string, loc string) (def Definition, ok bool, err error)
+}
+
+// Validate parses def the way RenderDefinition does, reporting syntax errors
+// and unknown functions as ErrInvalidTemplate.
+func (r *Registry) Validate(def Definition) error {
+	_, err := r.compileDefinition(def)
+	return err
+}
+
+// RenderDefinition executes def with data. Definitions are parsed on every
+// call, they can change while the files cannot.
+func (r *Registry) RenderDefinition(def Definition, data interface{}) (Content, error) {
+	tmpl, err := r.compileDefinition(def)
+	if err != nil {
+		return Content{}, err
+	}
+
+	return tmpl.execute(data)
+}
+
+// RenderFrom renders the published definition of source or the files,
+// whichever matches the fallback chain of loc first. For "id-ID" a
+// definition published for "id" is preferred to the English files, while
+// files for "id" are preferred to an English definition. Without a source it
+// is Render.
+func (r *Registry) RenderFrom(ctx context.Context, source Source, name string, loc string, data interface{}) (Content, error) {
+	if source != nil && validName(name) {
+		files := r.resolve(name, loc)
+		hasFiles := r.hasFiles(name, loc)
+
+		for _, candidate := range locale.Fallbacks(loc) {
+			def, ok, err := source.Published(ctx, name, candidate)
+			if err != nil {
+				return Content{}, err
+			}
+			if ok {
+				return r.RenderDefinition(def, data)
+			}
+			if candidate == files && hasFiles {
+				break
+			}
+		}
+	}
+
+	return r.Render(name, loc, data)
+}
+
+// hasFiles reports whether name has a file to render in loc.
+func (r *Registry) hasFiles(name string, loc string) bool {
+	return r.emailFile(name, loc, ".html").content != "" || r.emailFile(name, loc, ".txt").content != ""
+}
+
+func (r *Registry) compileDefinition(def Definition) (*parsed, error) {
+	if !validName(def.Name) {
+		return nil, fmt.Errorf("%w: name %q", ErrInvalidTemplate, def.Name)
+	}
+	if def.HTML == "" && def.Text == "" {
+		return nil, fmt.Errorf("%w: %q has neither HTML nor text", ErrInvalidTemplate, def.Name)
+	}
+
+	loc := locale.Normalize(def.Locale)
+	if loc == "" {
+		return nil, fmt.Errorf("%w: locale %q", ErrInvalidTemplate, def.Locale)
+	}
+
+	tmpl, err := r.compile(def.Name, loc, def.Subject,
+		part{name: def.Name + ".html", content: def.HTML},
+		part{name: def.Name + ".txt", content: def.Text},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTemplate, err)
+	}
+	tmpl.version = def.Version
+
+	return tmpl, nil
+}
@@ -0,0 +1,131 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource map[string]Definition
+
+func (s fakeSource) Published(ctx context.Context, name string, loc string) (Definition, bool, error) {
+	def, ok := s[name+":"+loc]
+	return def, ok, nil
+}
+
+type failingSource struct{}
+
+func (failingSource) Published(ctx context.Context, name string, loc string) (Definition, bool, error) {
+	return Definition{}, false, errors.New("connection refused")
+}
+
+func definitionRegistry() *Registry {
+	return newRegistry(fstest.MapFS{
+		"layouts/base.html":   {Data: []byte(`{{define "base"}}<h1>{{template "title" .}}</h1>{{template "content" .}}{{end}}`)},
+		"locales/en.json":     {Data: []byte(`{"welcome.subject": "Welcome", "welcome.title": "Hello"}`)},
+		"locales/id.json":     {Data: []byte(`{"welcome.subject": "Selamat datang", "welcome.title": "Halo"}`)},
+		"emails/welcome.html": {Data: []byte(`{{define "title"}}{{t "welcome.title"}}{{end}}{{define "content"}}<p>file {{locale}}</p>{{end}}`)},
+	}, false, Brand{Product: "Acme"})
+}
+
+func TestRenderDefinitionUsesLayoutAndCatalog(t *testing.T) {
+	registry := definitionRegistry()
+
+	content, err := registry.RenderDefinition(Definition{
+		Name:    "welcome",
+		Locale:  "id",
+		Version: 3,
+		Subject: "{{t \"welcome.title\"}} {{.Name}}, welcome to {{brand.Product}}",
+		HTML:    `{{define "title"}}{{t "welcome.title"}}{{end}}{{define "content"}}<p>{{.Name}}</p>{{end}}`,
+		Text:    `{{.Name}}`,
+	}, map[string]string{"Name": "Ardi"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "id", content.Locale)
+	assert.Equal(t, 3, content.Version)
+	assert.Equal(t, "Halo Ardi, welcome to Acme", content.Subject)
+	assert.Equal(t, "<h1>Halo</h1><p>Ardi</p>", content.HTML)
+	assert.Equal(t, "Ardi", content.Text)
+}
+
+func TestRenderDefinitionSubjectDefaultsToCatalog(t *testing.T) {
+	registry := definitionRegistry()
+
+	content, err := registry.RenderDefinition(Definition{Name: "welcome", Locale: "id", Text: "hi"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Selamat datang", content.Subject)
+}
+
+func TestValidateDefinition(t *testing.T) {
+	registry := definitionRegistry()
+
+	valid := Definition{Name: "welcome", Locale: "en", Subject: "Hi", HTML: "<p>{{.Name}}</p>"}
+	assert.NoError(t, registry.Validate(valid))
+
+	for name, def := range map[string]Definition{
+		"syntax":       {Name: "welcome", Locale: "en", HTML: "<p>{{.Name</p>"},
+		"unknown func": {Name: "welcome", Locale: "en", Text: "{{shout .Name}}"},
+		"subject":      {Name: "welcome", Locale: "en", Subject: "{{end}}", Text: "hi"},
+		"empty":        {Name: "welcome", Locale: "en", Subject: "Hi"},
+		"name":         {Name: "../welcome", Locale: "en", Text: "hi"},
+		"locale":       {Name: "welcome", Locale: "not a locale", Text: "hi"},
+	} {
+		assert.ErrorIs(t, registry.Validate(def), ErrInvalidTemplate, name)
+	}
+}
+
+func TestRenderFromPrefersClosestLocale(t *testing.T) {
+	registry := definitionRegistry()
+
+	published := func(loc string) Definition {
+		return Definition{Name: "welcome", Locale: loc, Version: 2, Text: "stored " + loc}
+	}
+
+	tests := []struct {
+		name    string
+		source  Source
+		locale  string
+		version int
+		text    string
+		html    string
+	}{
+		{name: "no source", source: nil, locale: "id-ID", html: "<h1>Halo</h1><p>file id</p>"},
+		{name: "nothing published", source: fakeSource{}, locale: "id-ID", html: "<h1>Halo</h1><p>file id</p>"},
+		{name: "published for the locale", source: fakeSource{"welcome:id": published("id")}, locale: "id-ID", version: 2, text: "stored id"},
+		{name: "published more specific", source: fakeSource{"welcome:id-ID": published("id-ID")}, locale: "id-ID", version: 2, text: "stored id-ID"},
+		// The Indonesian files are closer than the English definition
+		{name: "files closer", source: fakeSource{"welcome:en": published("en")}, locale: "id-ID", html: "<h1>Halo</h1><p>file id</p>"},
+		{name: "published default", source: fakeSource{"welcome:en": published("en")}, locale: "de", version: 2, text: "stored en"},
+	}
+
+	for _, tt := range tests {
+		content, err := registry.RenderFrom(context.Background(), tt.source, "welcome", tt.locale, nil)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.version, content.Version, tt.name)
+		assert.Equal(t, tt.text, content.Text, tt.name)
+		assert.Equal(t, tt.html, content.HTML, tt.name)
+	}
+}
+
+func TestRenderFromStoredOnlyTemplate(t *testing.T) {
+	registry := definitionRegistry()
+	source := fakeSource{"invoice:en": {Name: "invoice", Locale: "en", Text: "stored"}}
+
+	content, err := registry.RenderFrom(context.Background(), source, "invoice", "id", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "stored", content.Text)
+
+	_, err = registry.RenderFrom(context.Background(), source, "receipt", "id", nil)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+}
+
+func TestRenderFromSourceError(t *testing.T) {
+	registry := definitionRegistry()
+
+	_, err := registry.RenderFrom(context.Background(), failingSource{}, "welcome", "id", nil)
+	assert.EqualError(t, err, "connection refused")
+}
@@ -0,0 +1,356 @@
+package template
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"go_project_template/internal/locale"
+)
+
+//go:embed layouts partials emails locales samples
+var embedded embed.FS
+
+const (
+	layoutsDir  = "layouts"
+	partialsDir = "partials"
+	emailsDir   = "emails"
+
+	// baseLayout is executed when a layout defines it, the email then only
+	// defines the blocks the layout leaves open, such as "title" and
+	// "content".
+	baseLayout = "base"
+)
+
+var ErrTemplateNotFound = errors.New("template: not found")
+
+// Content is a rendered email in Locale, the locale that was picked from the
+// fallback chain of the requested one. Text is empty when the template has no
+// text version and Subject when the catalogs have no "<name>.subject".
+type Content struct {
+	Locale  string
+	Subject string
+	HTML    string
+	Text    string
+	// Version of the Definition that was rendered, 0 for the files
+	Version int
+}
+
+type parsed struct {
+	locale    string
+	subject   *texttemplate.Template
+	version   int
+	html      *htmltemplate.Template
+	htmlEntry string
+	text      *texttemplate.Template
+	textEntry string
+}
+
+// Registry looks up email templates by name. The template "confirm-email"
+// consists of emails/confirm-email.html and, optionally,
+// emails/confirm-email.txt, so a new notification type only needs new files.
+// Each of them is parsed together with the layouts and partials of the same
+// extension, which get the brand with {{brand}} and can be passed several
+// values with {{template "button" dict "URL" .URL "Label" "Confirm"}}.
+//
+// Copy is translated with {{t "key"}} from the catalogs in locales, see
+// loadCatalog. A locale can also replace an email completely with its own
+// file, such as emails/confirm-email.id.html.
+type Registry struct {
+	files  fs.FS
+	reload bool
+	funcs  map[string]interface{}
+
+	mu    sync.RWMutex
+	cache map[string]*parsed
+}
+
+// NewRegistry serves the templates embedded in the binary. With dir set,
+// templates are read from that directory instead and parsed again on every
+// render, so edits show up without a restart during development.
+func NewRegistry(dir string, brand Brand) *Registry {
+	if dir == "" {
+		return newRegistry(embedded, false, brand)
+	}
+	return newRegistry(os.DirFS(dir), true, brand)
+}
+
+func newRegistry(files fs.FS, reload bool, brand Brand) *Registry {
+	return &Registry{
+		files:  files,
+		reload: reload,
+		funcs: map[string]interface{}{
+			"brand": func() Brand { return brand },
+			"dict":  dict,
+		},
+		cache: map[string]*parsed{},
+	}
+}
+
+// Names lists the available templates.
+func (r *Registry) Names() ([]string, error) {
+	entries, err := fs.ReadDir(r.files, emailsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".html" && ext != ".txt") {
+			continue
+		}
+
+		// confirm-email.id.html is a variant of confirm-email
+		name, _, _ := strings.Cut(strings.TrimSuffix(entry.Name(), ext), ".")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Render executes the template with data in the most specific locale of the
+// fallback chain of loc that has a catalog or a variant of the template, for
+// "id-ID" that is the first of "id-ID", "id" and the default locale.
+func (r *Registry) Render(name string, loc string, data interface{}) (Content, error) {
+	tmpl, err := r.lookup(name, loc)
+	if err != nil {
+		return Content{}, err
+	}
+
+	return tmpl.execute(data)
+}
+
+func (tmpl *parsed) execute(data interface{}) (Content, error) {
+	content := Content{
+		Locale:  tmpl.locale,
+		Version: tmpl.version,
+	}
+
+	if tmpl.subject != nil {
+		buff := new(bytes.Buffer)
+		if err := tmpl.subject.Execute(buff, data); err != nil {
+			return Content{}, err
+		}
+		content.Subject = buff.String()
+	}
+
+	if tmpl.html != nil {
+		buff := new(bytes.Buffer)
+		if err := tmpl.html.ExecuteTemplate(buff, tmpl.htmlEntry, data); err != nil {
+			return Content{}, err
+		}
+		content.HTML = buff.String()
+	}
+
+	if tmpl.text != nil {
+		buff := new(bytes.Buffer)
+		if err := tmpl.text.ExecuteTemplate(buff, tmpl.textEntry, data); err != nil {
+			return Content{}, err
+		}
+		content.Text = buff.String()
+	}
+
+	return content, nil
+}
+
+func (r *Registry) lookup(name string, loc string) (*parsed, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("%w: %q", ErrTemplateNotFound, name)
+	}
+
+	// Resolving first keeps one cache entry per locale that has files, however
+	// many tags the messages carry
+	loc = r.resolve(name, loc)
+	if r.reload {
+		return r.parse(name, loc)
+	}
+
+	key := name + ":" + loc
+
+	r.mu.RLock()
+	tmpl, ok := r.cache[key]
+	r.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := r.parse(name, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = tmpl
+	r.mu.Unlock()
+
+	return tmpl, nil
+}
+
+// resolve picks the most specific locale of the fallback chain of loc that
+// has a catalog or a variant of the template.
+func (r *Registry) resolve(name string, loc string) string {
+	for _, candidate := range locale.Fallbacks(loc) {
+		if r.exists(path.Join(localesDir, candidate+".json")) ||
+			r.exists(path.Join(emailsDir, name+"."+candidate+".html")) ||
+			r.exists(path.Join(emailsDir, name+"."+candidate+".txt")) {
+			return candidate
+		}
+	}
+	return locale.Default
+}
+
+func (r *Registry) parse(name string, loc string) (*parsed, error) {
+	tmpl, err := r.compile(name, loc, "", r.emailFile(name, loc, ".html"), r.emailFile(name, loc, ".txt"))
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.html == nil && tmpl.text == nil {
+		return nil, fmt.Errorf("%w: %q", ErrTemplateNotFound, name)
+	}
+
+	return tmpl, nil
+}
+
+// part is the email part of a template, parsed after the layouts and
+// partials so its blocks override their defaults. An empty content means the
+// template has no such version.
+type part struct {
+	name    string
+	content string
+}
+
+// compile parses html and text with the layouts and partials of the same
+// extension and the catalog of loc. The subject is a text template too,
+// "<name>.subject" of the catalog when subject is empty.
+func (r *Registry) compile(name string, loc string, subject string, html part, text part) (*parsed, error) {
+	messages, err := r.loadCatalog(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := map[string]interface{}{
+		"t":      messages.translate,
+		"locale": func() string { return loc },
+	}
+	for key, fn := range r.funcs {
+		funcs[key] = fn
+	}
+
+	tmpl := parsed{locale: loc}
+
+	if subject == "" {
+		subject = messages[name+".subject"]
+	}
+	if subject != "" {
+		if tmpl.subject, err = texttemplate.New("subject").Funcs(funcs).Parse(subject); err != nil {
+			return nil, err
+		}
+	}
+
+	if html.content != "" {
+		t := htmltemplate.New(html.name).Funcs(funcs)
+		if shared := r.sharedFiles(".html"); len(shared) > 0 {
+			if t, err = t.ParseFS(r.files, shared...); err != nil {
+				return nil, err
+			}
+		}
+		if t, err = t.Parse(html.content); err != nil {
+			return nil, err
+		}
+		tmpl.html, tmpl.htmlEntry = t, entry(t.Lookup(baseLayout) != nil, html.name)
+	}
+
+	if text.content != "" {
+		t := texttemplate.New(text.name).Funcs(funcs)
+		if shared := r.sharedFiles(".txt"); len(shared) > 0 {
+			if t, err = t.ParseFS(r.files, shared...); err != nil {
+				return nil, err
+			}
+		}
+		if t, err = t.Parse(text.content); err != nil {
+			return nil, err
+		}
+		tmpl.text, tmpl.textEntry = t, entry(t.Lookup(baseLayout) != nil, text.name)
+	}
+
+	return &tmpl, nil
+}
+
+// emailFile reads the variant of the email for the closest locale in the
+// fallback chain of loc, or else the file without a locale.
+func (r *Registry) emailFile(name string, loc string, ext string) part {
+	for _, candidate := range append(locale.Fallbacks(loc), "") {
+		file := path.Join(emailsDir, name+ext)
+		if candidate != "" {
+			file = path.Join(emailsDir, name+"."+candidate+ext)
+		}
+
+		content, err := fs.ReadFile(r.files, file)
+		if err == nil {
+			return part{name: path.Base(file), content: string(content)}
+		}
+	}
+
+	return part{}
+}
+
+// sharedFiles lists the layouts and partials with the extension ext.
+func (r *Registry) sharedFiles(ext string) []string {
+	var files []string
+	for _, dir := range []string{layoutsDir, partialsDir} {
+		matches, _ := fs.Glob(r.files, path.Join(dir, "*"+ext))
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// entry is the template to execute, the base layout or else the email.
+func entry(hasLayout bool, name string) string {
+	if hasLayout {
+		return baseLayout
+	}
+	return name
+}
+
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\.`) && fs.ValidPath(name)
+}
+
+func (r *Registry) exists(file string) bool {
+	_, err := fs.Stat(r.files, file)
+	return err == nil
+}
+
+// dict builds a map from key and value pairs, so a partial can be given more
+// than one value.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("template: dict needs key and value pairs")
+	}
+
+	values := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("template: dict key %v is not a string", pairs[i])
+		}
+		values[key] = pairs[i+1]
+	}
+
+	return values, nil
+}
@@ -0,0 +1,219 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedConfirmEmail(t *testing.T) {
+	registry := NewRegistry("", DefaultBrand)
+
+	names, err := registry.Names()
+	require.NoError(t, err)
+	assert.Contains(t, names, "confirm-email")
+
+	content, err := registry.Render("confirm-email", "", map[string]interface{}{
+		"OTPCode": "123456",
+		"URL":     "http://localhost:8080/api/verify-otp?otp_code=123456",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, content.HTML, "Your OTP Code Is 123456")
+	assert.Contains(t, content.HTML, "http://localhost:8080/api/verify-otp")
+	assert.Contains(t, content.HTML, "get started using Mata Duitan.")
+	assert.Contains(t, content.HTML, "background:#2F67F6")
+	assert.Contains(t, content.HTML, "Some Firm Ltd")
+	assert.Contains(t, content.Text, "Your OTP Code Is 123456")
+	assert.Contains(t, content.Text, "get started using Mata Duitan")
+	assert.Contains(t, content.Text, "Some Firm Ltd")
+	assert.Equal(t, "en", content.Locale)
+	assert.Equal(t, "OTP Request", content.Subject)
+}
+
+func TestEmbeddedConfirmEmailInIndonesian(t *testing.T) {
+	registry := NewRegistry("", DefaultBrand)
+
+	content, err := registry.Render("confirm-email", "id-ID", map[string]interface{}{
+		"OTPCode": "123456",
+		"URL":     "http://localhost:8080/api/verify-otp?otp_code=123456",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "id", content.Locale)
+	assert.Equal(t, "Permintaan Kode OTP", content.Subject)
+	assert.Contains(t, content.HTML, `<html lang="id"`)
+	assert.Contains(t, content.HTML, "Kode OTP Anda adalah 123456")
+	assert.Contains(t, content.HTML, "mulai menggunakan Mata Duitan.")
+	assert.Contains(t, content.Text, "Kode OTP Anda adalah 123456")
+}
+
+func TestRegistryLocaleFallbacks(t *testing.T) {
+	registry := newRegistry(fstest.MapFS{
+		"locales/en.json":        {Data: []byte(`{"welcome.subject": "Welcome", "welcome.greeting": "Hello %s", "welcome.bye": "Bye"}`)},
+		"locales/id.json":        {Data: []byte(`{"welcome.subject": "Selamat datang", "welcome.greeting": "Halo %s"}`)},
+		"emails/welcome.html":    {Data: []byte(`<p>{{t "welcome.greeting" .}}</p><p>{{t "welcome.bye"}}</p>`)},
+		"emails/welcome.fr.html": {Data: []byte(`<p>Bonjour {{.}}</p>`)},
+	}, false, DefaultBrand)
+
+	tests := []struct {
+		locale  string
+		want    string
+		subject string
+		html    string
+	}{
+		// Missing keys come from the next locale in the chain
+		{locale: "id-ID", want: "id", subject: "Selamat datang", html: "<p>Halo Ardi</p><p>Bye</p>"},
+		{locale: "id", want: "id", subject: "Selamat datang", html: "<p>Halo Ardi</p><p>Bye</p>"},
+		// A variant replaces the template, the subject falls back to English
+		{locale: "fr-CA", want: "fr", subject: "Welcome", html: "<p>Bonjour Ardi</p>"},
+		{locale: "de", want: "en", subject: "Welcome", html: "<p>Hello Ardi</p><p>Bye</p>"},
+		{locale: "", want: "en", subject: "Welcome", html: "<p>Hello Ardi</p><p>Bye</p>"},
+		{locale: "../../etc", want: "en", subject: "Welcome", html: "<p>Hello Ardi</p><p>Bye</p>"},
+	}
+
+	for _, tt := range tests {
+		content, err := registry.Render("welcome", tt.locale, "Ardi")
+		require.NoError(t, err, tt.locale)
+		assert.Equal(t, tt.want, content.Locale, tt.locale)
+		assert.Equal(t, tt.subject, content.Subject, tt.locale)
+		assert.Equal(t, tt.html, content.HTML, tt.locale)
+	}
+
+	names, err := registry.Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"welcome"}, names)
+}
+
+func TestRegistryMissingTranslation(t *testing.T) {
+	registry := newRegistry(fstest.MapFS{
+		"locales/en.json":     {Data: []byte(`{}`)},
+		"emails/welcome.html": {Data: []byte(`<p>{{t "welcome.greeting"}}</p>`)},
+	}, false, DefaultBrand)
+
+	_, err := registry.Render("welcome", "id", nil)
+	assert.ErrorIs(t, err, ErrMissingTranslation)
+}
+
+func TestRegistryAppliesLayoutAndBrand(t *testing.T) {
+	brand := Brand{
+		Product:        "Acme",
+		Address:        "1 Acme Way",
+		PrimaryColor:   "#ff0000",
+		UnsubscribeURL: "https://acme.test/unsubscribe",
+	}
+	registry := newRegistry(fstest.MapFS{
+		"layouts/base.html":    {Data: []byte(`{{define "base"}}<h1>{{template "title" .}}</h1>{{template "content" .}}{{template "footer" .}}{{end}}`)},
+		"layouts/base.txt":     {Data: []byte(`{{define "base"}}{{template "title" .}}: {{template "content" .}}{{end}}`)},
+		"partials/button.html": {Data: []byte(`{{define "button"}}<a href="{{.URL}}" style="color:{{brand.PrimaryColor}}">{{.Label}}</a>{{end}}`)},
+		"partials/footer.html": {Data: []byte(`{{define "footer"}}<p>{{brand.Address}} <a href="{{brand.UnsubscribeURL}}">Unsubscribe</a></p>{{end}}`)},
+		"emails/welcome.html":  {Data: []byte(`{{define "title"}}Welcome to {{brand.Product}}{{end}}{{define "content"}}{{template "button" dict "URL" .URL "Label" "Start"}}{{end}}`)},
+		"emails/welcome.txt":   {Data: []byte(`{{define "title"}}Welcome{{end}}{{define "content"}}{{.URL}}{{end}}`)},
+	}, false, brand)
+
+	content, err := registry.Render("welcome", "", map[string]string{"URL": "https://acme.test/start"})
+	require.NoError(t, err)
+	assert.Equal(t, `<h1>Welcome to Acme</h1><a href="https://acme.test/start" style="color:#ff0000">Start</a><p>1 Acme Way <a href="https://acme.test/unsubscribe">Unsubscribe</a></p>`, content.HTML)
+	assert.Equal(t, "Welcome: https://acme.test/start", content.Text)
+}
+
+func TestBrandFromEnv(t *testing.T) {
+	t.Setenv("BRAND_PRODUCT", "Acme")
+	t.Setenv("BRAND_PRIMARY_COLOR", "#ff0000")
+
+	brand := BrandFromEnv()
+	assert.Equal(t, "Acme", brand.Product)
+	assert.Equal(t, "#ff0000", brand.PrimaryColor)
+	assert.Equal(t, DefaultBrand.LogoURL, brand.LogoURL)
+}
+
+func TestRegistryRendersByName(t *testing.T) {
+	registry := newRegistry(fstest.MapFS{
+		"emails/welcome.html":   {Data: []byte("<p>Hello {{.Name}}</p>")},
+		"emails/welcome.txt":    {Data: []byte("Hello {{.Name}}")},
+		"emails/html-only.html": {Data: []byte("<p>{{.}}</p>")},
+		"emails/notes.md":       {Data: []byte("not a template")},
+	}, false, DefaultBrand)
+
+	names, err := registry.Names()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"html-only", "welcome"}, names)
+
+	content, err := registry.Render("welcome", "", map[string]string{"Name": "<Ardi>"})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>Hello &lt;Ardi&gt;</p>", content.HTML)
+	assert.Equal(t, "Hello <Ardi>", content.Text)
+
+	content, err = registry.Render("html-only", "", "hi")
+	require.NoError(t, err)
+	assert.Equal(t, "<p>hi</p>", content.HTML)
+	assert.Empty(t, content.Text)
+}
+
+func TestRegistryUnknownTemplate(t *testing.T) {
+	registry := newRegistry(fstest.MapFS{
+		"emails/welcome.html": {Data: []byte("<p>Hello</p>")},
+	}, false, DefaultBrand)
+
+	for _, name := range []string{"missing", "", "../welcome", "sub/welcome", "welcome.fr"} {
+		_, err := registry.Render(name, "", nil)
+		assert.ErrorIs(t, err, ErrTemplateNotFound, name)
+	}
+}
+
+func TestRegistryCachesParsedTemplates(t *testing.T) {
+	files := fstest.MapFS{
+		"emails/welcome.html": {Data: []byte("<p>v1</p>")},
+	}
+	registry := newRegistry(files, false, DefaultBrand)
+
+	content, err := registry.Render("welcome", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>v1</p>", content.HTML)
+
+	files["emails/welcome.html"] = &fstest.MapFile{Data: []byte("<p>v2</p>")}
+
+	content, err = registry.Render("welcome", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>v1</p>", content.HTML)
+}
+
+func TestRegistryDirectoryOverrideReloads(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "emails"), 0o700))
+	file := filepath.Join(dir, "emails", "welcome.html")
+	require.NoError(t, os.WriteFile(file, []byte("<p>v1</p>"), 0o600))
+
+	registry := NewRegistry(dir, DefaultBrand)
+
+	content, err := registry.Render("welcome", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>v1</p>", content.HTML)
+
+	require.NoError(t, os.WriteFile(file, []byte("<p>v2</p>"), 0o600))
+
+	content, err = registry.Render("welcome", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>v2</p>", content.HTML)
+}
+
+func TestRegistrySamples(t *testing.T) {
+	sample, err := NewRegistry("", DefaultBrand).Sample("confirm-email")
+	require.NoError(t, err)
+	assert.Equal(t, "123456", sample["OTPCode"])
+
+	registry := newRegistry(fstest.MapFS{
+		"samples/broken.json": {Data: []byte(`{"OTPCode": `)},
+	}, false, DefaultBrand)
+
+	sample, err = registry.Sample("welcome")
+	require.NoError(t, err)
+	assert.Empty(t, sample)
+
+	_, err = registry.Sample("broken")
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+const samplesDir = "samples"
+
+// Sample reads samples/<name>.json, the data name is previewed with when the
+// caller supplies none. A template without a sample file gets an empty map.
+func (r *Registry) Sample(name string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	if !validName(name) {
+		return data, nil
+	}
+
+	file := path.Join(samplesDir, name+".json")
+	content, err := fs.ReadFile(r.files, file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("template: %s: %w", file, err)
+	}
+
+	return data, nil
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"database/sql"
 	"go_project_template/internal/exception"
+	"go_project_template/internal/locale"
 	"go_project_template/internal/user/model"
 	"go_project_template/internal/user/usecase"
 	"net/http"
@@ -179,6 +180,11 @@ func (controller *UserController) UserRegistration(ctx *gin.Context) {
 		return
 	}
 
+	// Without a locale in the body, emails use the language of the browser
+	if newUser.Locale == "" {
+		newUser.Locale = locale.FromAcceptLanguage(ctx.GetHeader("Accept-Language"))
+	}
+
 	// Add user
 	err := controller.userUseCase.RegisterUser(ctx, newUser)
 
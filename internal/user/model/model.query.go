@@ -8,6 +8,7 @@ type User struct {
 	Email      string    `json:"email" binding:"required,email"`
 	Password   string    `json:"password,omitempty" binding:"required"`
 	IsVerified bool      `json:"is_verified"`
+	Locale     string    `json:"locale,omitempty" binding:"omitempty,bcp47_language_tag"`
 	CreatedAt  time.Time `json:"created_at,omitempty"`
 	UpdatedAt  time.Time `json:"updated_at,omitempty"`
 }
@@ -4,13 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"go_project_template/configs/db"
+	"go_project_template/internal/outbox"
 	"go_project_template/internal/user/model"
 )
 
 type IUserRepository interface {
 	GetUsers(ctx context.Context) ([]model.User, error)
 	GetUserById(ctx context.Context, id int64) (model.User, error)
-	AddNewUser(ctx context.Context, newUser model.User) (int64, error)
+	AddNewUser(ctx context.Context, newUser model.User, events ...outbox.Event) (int64, error)
 	UpdateUser(ctx context.Context, user model.User) (int64, error)
 	DeleteUser(ctx context.Context, id int64) error
 	UpdateEmailVerificationStatus(ctx context.Context, email string) error
@@ -86,19 +87,29 @@ func (q *UserRepository) GetUserById(ctx context.Context, id int64) (model.User,
 	return user, nil
 }
 
-func (q *UserRepository) AddNewUser(ctx context.Context, newUser model.User) (int64, error) {
+// AddNewUser inserts the user and writes events to the outbox in the same
+// transaction, so they are published if and only if the user is created.
+func (q *UserRepository) AddNewUser(ctx context.Context, newUser model.User, events ...outbox.Event) (int64, error) {
 
 	var newId int64
 
 	sqlStatement := `
 	INSERT INTO
-    "user".users(fullname, email, password)
+    "user".users(fullname, email, password, locale)
 	VALUES
-			($1, $2, $3)
+			($1, $2, $3, $4)
 	RETURNING user_id
 	`
 
-	err := q.db.QueryRowContext(ctx, sqlStatement, newUser.Fullname, newUser.Email, newUser.Password).Scan(&newId)
+	err := db.Transaction(ctx, q.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, sqlStatement, newUser.Fullname, newUser.Email, newUser.Password, newUser.Locale).Scan(&newId)
+
+		if err != nil {
+			return err
+		}
+
+		return outbox.Insert(ctx, tx, events...)
+	})
 
 	if err != nil {
 		return 0, err
@@ -186,6 +197,7 @@ func (q *UserRepository) FindByEmail(ctx context.Context, email string) (model.U
 			fullname,
 			email,
 			is_verified,
+			locale,
 			created_at,
 			updated_at
 		FROM "user".users
@@ -198,6 +210,7 @@ func (q *UserRepository) FindByEmail(ctx context.Context, email string) (model.U
 		&user.Fullname,
 		&user.Email,
 		&user.IsVerified,
+		&user.Locale,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"go_project_template/internal/outbox"
+	"go_project_template/internal/user/model"
 	"go_project_template/internal/user/repository"
 	"regexp"
 	"testing"
@@ -132,3 +134,51 @@ func BenchmarkGetUserById(b *testing.B) {
 		panic(err)
 	}
 }
+
+func TestAddNewUserWritesOutboxInTransaction(t *testing.T) {
+	db, mock := NewDBMock()
+	defer db.Close()
+
+	Repository := repository.NewUserRepository(db)
+
+	event, err := outbox.NewEvent("notification.email.otp", "email.otp", 1, map[string]string{"email": "john.doe@mail.com"})
+	assert.NoError(t, err)
+	event.Envelope.Locale = "id-ID"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`"user".users(fullname, email, password, locale)`)).
+		WithArgs("John Doe", "john.doe@mail.com", "hashed", "id-ID").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(int64(7)))
+	mock.ExpectExec(regexp.QuoteMeta(`"user".outbox`)).
+		WithArgs(event.Envelope.ID, "notification.email.otp", "email.otp", 1, "", "", "id-ID", 0, []byte(event.Envelope.Payload), event.Envelope.CreatedAt, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	id, err := Repository.AddNewUser(context.Background(), model.User{Fullname: "John Doe", Email: "john.doe@mail.com", Password: "hashed", Locale: "id-ID"}, event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddNewUserRollsBackWhenOutboxFails(t *testing.T) {
+	db, mock := NewDBMock()
+	defer db.Close()
+
+	Repository := repository.NewUserRepository(db)
+
+	event, err := outbox.NewEvent("notification.email.otp", "email.otp", 1, map[string]string{"email": "john.doe@mail.com"})
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`"user".users(fullname, email, password, locale)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(int64(7)))
+	mock.ExpectExec(regexp.QuoteMeta(`"user".outbox`)).
+		WillReturnError(fmt.Errorf("relation \"user\".outbox does not exist"))
+	mock.ExpectRollback()
+
+	_, err = Repository.AddNewUser(context.Background(), model.User{Fullname: "John Doe", Email: "john.doe@mail.com", Password: "hashed"}, event)
+
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,13 +2,14 @@ package usecase
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
-	queueclient "go_project_template/configs/queue_client"
 	"go_project_template/internal/auth"
+	"go_project_template/internal/locale"
+	"go_project_template/internal/notification"
+	"go_project_template/internal/outbox"
 	"go_project_template/internal/user/model"
 	"go_project_template/internal/user/repository"
 	"go_project_template/internal/utils"
@@ -29,14 +30,14 @@ type IUserUseCase interface {
 type UserUseCase struct {
 	userRepo  repository.IUserRepository
 	userCache repository.IUserRedisRepository
-	publisher *queueclient.Publisher
+	outbox    outbox.IOutboxRepository
 }
 
-func NewUserUseCae(userRepo repository.IUserRepository, userCache repository.IUserRedisRepository, publisher *queueclient.Publisher) *UserUseCase {
+func NewUserUseCae(userRepo repository.IUserRepository, userCache repository.IUserRedisRepository, outbox outbox.IOutboxRepository) *UserUseCase {
 	return &UserUseCase{
 		userRepo:  userRepo,
 		userCache: userCache,
-		publisher: publisher,
+		outbox:    outbox,
 	}
 }
 
@@ -74,6 +75,7 @@ func (uc *UserUseCase) RegisterUser(ctx context.Context, newUser model.User) err
 		return nil
 	}
 	newUser.Password = hashedPassword
+	newUser.Locale = locale.Normalize(newUser.Locale)
 
 	// Generate OTP
 	otp, secret, err := utils.GenerateOTP(newUser.Email)
@@ -97,8 +99,16 @@ func (uc *UserUseCase) RegisterUser(ctx context.Context, newUser model.User) err
 	if err != nil {
 		return err
 	}
-	// Insert user to database
-	_, err = uc.userRepo.AddNewUser(ctx, newUser)
+
+	event, err := verificationEmailEvent(userOTPVerification, newUser.Locale)
+
+	if err != nil {
+		return err
+	}
+
+	// Insert user to database, the verification email is queued in the same
+	// transaction
+	_, err = uc.userRepo.AddNewUser(ctx, newUser, event)
 
 	if err != nil {
 		return err
@@ -141,19 +151,13 @@ func (uc *UserUseCase) RequestNewOTP(ctx context.Context, email string) error {
 		return err
 	}
 
-	verificationEmailPayload := model.OTPVerificationEmailContent{
-		Email:   userOTPVerification.Email,
-		OTPCode: userOTPVerification.OTPCode,
-		Url:     fmt.Sprintf("http://localhost:8080/api/user-service/verify-otp?otp_code=%s", userOTPVerification.OTPCode),
-	}
-
-	publishPayload, err := json.Marshal(verificationEmailPayload)
+	event, err := verificationEmailEvent(userOTPVerification, user.Locale)
 
 	if err != nil {
 		return err
 	}
 
-	err = uc.publisher.Publish(ctx, "mailQueue", publishPayload)
+	err = uc.outbox.Enqueue(ctx, event)
 
 	if err != nil {
 		return err
@@ -162,6 +166,24 @@ func (uc *UserUseCase) RequestNewOTP(ctx context.Context, email string) error {
 	return nil
 }
 
+func verificationEmailEvent(userOTPVerification model.UserOTPVerification, userLocale string) (outbox.Event, error) {
+	verificationEmailPayload := model.OTPVerificationEmailContent{
+		Email:   userOTPVerification.Email,
+		OTPCode: userOTPVerification.OTPCode,
+		Url:     fmt.Sprintf("http://localhost:8080/api/user-service/verify-otp?otp_code=%s", userOTPVerification.OTPCode),
+	}
+
+	event, err := outbox.NewEvent(notification.RoutingKeyEmailOTP, notification.TypeEmailOTP, notification.TypeEmailOTPVersion, verificationEmailPayload)
+
+	if err != nil {
+		return event, err
+	}
+
+	event.Envelope.Priority = notification.PriorityTransactional
+	event.Envelope.Locale = userLocale
+	return event, nil
+}
+
 func (uc *UserUseCase) VerifyOTP(ctx context.Context, otpCode string) (string, error) {
 	// Get the user otp secret from cache
 	userOTP, err := uc.userCache.GetUserOTP(ctx, otpCode)
@@ -0,0 +1,149 @@
+package usecase_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go_project_template/internal/notification"
+	"go_project_template/internal/outbox"
+	"go_project_template/internal/user/model"
+	"go_project_template/internal/user/usecase"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUserRepository struct {
+	users  map[string]model.User
+	events []outbox.Event
+	err    error
+}
+
+func (r *fakeUserRepository) GetUsers(ctx context.Context) ([]model.User, error) {
+	return nil, nil
+}
+
+func (r *fakeUserRepository) GetUserById(ctx context.Context, id int64) (model.User, error) {
+	return model.User{}, sql.ErrNoRows
+}
+
+func (r *fakeUserRepository) AddNewUser(ctx context.Context, newUser model.User, events ...outbox.Event) (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	r.users[newUser.Email] = newUser
+	r.events = append(r.events, events...)
+	return int64(len(r.users)), nil
+}
+
+func (r *fakeUserRepository) UpdateUser(ctx context.Context, user model.User) (int64, error) {
+	return 0, nil
+}
+
+func (r *fakeUserRepository) DeleteUser(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (r *fakeUserRepository) UpdateEmailVerificationStatus(ctx context.Context, email string) error {
+	return nil
+}
+
+func (r *fakeUserRepository) FindByEmail(ctx context.Context, email string) (model.User, error) {
+	user, ok := r.users[email]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+type fakeUserCache struct {
+	otps map[string]model.UserOTPVerification
+}
+
+func (c *fakeUserCache) SetUserOTP(ctx context.Context, key string, userOTP model.UserOTPVerification, expiration time.Duration) error {
+	c.otps[key] = userOTP
+	return nil
+}
+
+func (c *fakeUserCache) GetUserOTP(ctx context.Context, key string) (model.UserOTPVerification, error) {
+	return c.otps[key], nil
+}
+
+func (c *fakeUserCache) RemoveUserOTP(ctx context.Context, key string) error {
+	delete(c.otps, key)
+	return nil
+}
+
+type fakeOutbox struct {
+	events []outbox.Event
+}
+
+func (o *fakeOutbox) Enqueue(ctx context.Context, events ...outbox.Event) error {
+	o.events = append(o.events, events...)
+	return nil
+}
+
+func newUserUseCase(users ...model.User) (*usecase.UserUseCase, *fakeUserRepository, *fakeOutbox) {
+	repo := &fakeUserRepository{users: map[string]model.User{}}
+	for _, user := range users {
+		repo.users[user.Email] = user
+	}
+	box := &fakeOutbox{}
+
+	return usecase.NewUserUseCae(repo, &fakeUserCache{otps: map[string]model.UserOTPVerification{}}, box), repo, box
+}
+
+func assertVerificationEmail(t *testing.T, event outbox.Event, email string, locale string) {
+	assert.Equal(t, notification.RoutingKeyEmailOTP, event.RoutingKey)
+	assert.Equal(t, notification.TypeEmailOTP, event.Envelope.Type)
+	assert.Equal(t, notification.TypeEmailOTPVersion, event.Envelope.Version)
+	assert.Equal(t, notification.PriorityTransactional, event.Envelope.Priority)
+	assert.Equal(t, locale, event.Envelope.Locale)
+
+	var content model.OTPVerificationEmailContent
+	require.NoError(t, event.Envelope.Decode(&content))
+	assert.Equal(t, email, content.Email)
+	assert.Len(t, content.OTPCode, 6)
+}
+
+func TestRegisterUserQueuesVerificationEmailWithUser(t *testing.T) {
+	uc, repo, box := newUserUseCase()
+
+	err := uc.RegisterUser(context.Background(), model.User{Fullname: "John Doe", Email: "john.doe@mail.com", Password: "secret", Locale: "id_id"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "id-ID", repo.users["john.doe@mail.com"].Locale)
+	require.Len(t, repo.events, 1)
+	assertVerificationEmail(t, repo.events[0], "john.doe@mail.com", "id-ID")
+	assert.Empty(t, box.events)
+}
+
+func TestRegisterUserQueuesNothingWhenInsertFails(t *testing.T) {
+	uc, repo, box := newUserUseCase()
+	repo.err = errors.New("duplicate key value violates unique constraint")
+
+	err := uc.RegisterUser(context.Background(), model.User{Fullname: "John Doe", Email: "john.doe@mail.com", Password: "secret"})
+
+	assert.Error(t, err)
+	assert.Empty(t, repo.events)
+	assert.Empty(t, box.events)
+}
+
+func TestRequestNewOTPQueuesVerificationEmail(t *testing.T) {
+	uc, _, box := newUserUseCase(model.User{Email: "john.doe@mail.com", Locale: "id"})
+
+	require.NoError(t, uc.RequestNewOTP(context.Background(), "john.doe@mail.com"))
+
+	require.Len(t, box.events, 1)
+	assertVerificationEmail(t, box.events[0], "john.doe@mail.com", "id")
+}
+
+func TestRequestNewOTPRejectsVerifiedUser(t *testing.T) {
+	uc, _, box := newUserUseCase(model.User{Email: "john.doe@mail.com", IsVerified: true})
+
+	assert.Error(t, uc.RequestNewOTP(context.Background(), "john.doe@mail.com"))
+	assert.Empty(t, box.events)
+}
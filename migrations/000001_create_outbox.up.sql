@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS "user".outbox (
+    id             BIGSERIAL PRIMARY KEY,
+    message_id     TEXT        NOT NULL,
+    routing_key    TEXT        NOT NULL,
+    message_type   TEXT        NOT NULL,
+    version        INTEGER     NOT NULL,
+    correlation_id TEXT        NOT NULL DEFAULT '',
+    tenant         TEXT        NOT NULL DEFAULT '',
+    payload        JSONB       NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at        TIMESTAMPTZ,
+    attempts       INTEGER     NOT NULL DEFAULT 0,
+    last_error     TEXT
+);
+
+-- The relay only ever scans unsent rows
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON "user".outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_sent_at_idx ON "user".outbox (sent_at) WHERE sent_at IS NOT NULL;
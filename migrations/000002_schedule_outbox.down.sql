@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS "user".outbox_message_id_idx;
+DROP INDEX IF EXISTS "user".outbox_due_idx;
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON "user".outbox (id) WHERE sent_at IS NULL;
+
+ALTER TABLE "user".outbox
+    DROP COLUMN IF EXISTS cancelled_at,
+    DROP COLUMN IF EXISTS available_at;
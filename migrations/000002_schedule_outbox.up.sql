@@ -0,0 +1,8 @@
+ALTER TABLE "user".outbox
+    ADD COLUMN IF NOT EXISTS available_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
+
+-- The relay scans unsent rows by due time, Cancel looks them up by message ID
+DROP INDEX IF EXISTS "user".outbox_pending_idx;
+CREATE INDEX IF NOT EXISTS outbox_due_idx ON "user".outbox (available_at, id) WHERE sent_at IS NULL AND cancelled_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_message_id_idx ON "user".outbox (message_id);
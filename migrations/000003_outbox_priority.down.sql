@@ -0,0 +1,2 @@
+ALTER TABLE "user".outbox
+    DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,2 @@
+ALTER TABLE "user".outbox
+    ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 0;
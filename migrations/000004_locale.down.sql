@@ -0,0 +1,5 @@
+ALTER TABLE "user".outbox
+    DROP COLUMN IF EXISTS locale;
+
+ALTER TABLE "user".users
+    DROP COLUMN IF EXISTS locale;
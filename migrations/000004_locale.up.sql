@@ -0,0 +1,5 @@
+ALTER TABLE "user".users
+    ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE "user".outbox
+    ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS notification.email_templates;
@@ -0,0 +1,19 @@
+CREATE SCHEMA IF NOT EXISTS notification;
+
+CREATE TABLE IF NOT EXISTS notification.email_templates (
+    id           BIGSERIAL PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    locale       TEXT        NOT NULL,
+    version      INTEGER     NOT NULL,
+    status       TEXT        NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'published', 'archived')),
+    subject      TEXT        NOT NULL DEFAULT '',
+    html         TEXT        NOT NULL DEFAULT '',
+    text         TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ,
+    UNIQUE (name, locale, version)
+);
+
+-- At most one version of a template is published per locale
+CREATE UNIQUE INDEX IF NOT EXISTS email_templates_published_idx ON notification.email_templates (name, locale) WHERE status = 'published';
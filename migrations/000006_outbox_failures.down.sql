@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS "user".outbox_failed_at_idx;
+DROP INDEX IF EXISTS "user".outbox_due_idx;
+CREATE INDEX IF NOT EXISTS outbox_due_idx ON "user".outbox (available_at, id) WHERE sent_at IS NULL AND cancelled_at IS NULL;
+
+ALTER TABLE "user".outbox
+    DROP COLUMN IF EXISTS failed_at,
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS locked_until;
@@ -0,0 +1,9 @@
+ALTER TABLE "user".outbox
+    ADD COLUMN IF NOT EXISTS locked_until    TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS failed_at       TIMESTAMPTZ;
+
+-- Rows the relay gave up on are no longer pending
+DROP INDEX IF EXISTS "user".outbox_due_idx;
+CREATE INDEX IF NOT EXISTS outbox_due_idx ON "user".outbox (available_at, id) WHERE sent_at IS NULL AND cancelled_at IS NULL AND failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_failed_at_idx ON "user".outbox (failed_at) WHERE failed_at IS NOT NULL;